@@ -1,7 +1,8 @@
 /*
 	This does not directly connect to a twitch channel
 
-	However, it utilizes the twitch-reader which exposes data on a pub|sub channel
+	However, it utilizes the twitch-reader which publishes chat to a RabbitMQ topic exchange,
+	the bot reads it through a durable queue so commands sent while it restarts are not lost.
 
 	We require one IRC connection to type in chat.
 	This IRC connection does not need to be connected to a channel.
@@ -17,8 +18,10 @@ import (
 	"github.com/JoachimFlottorp/magnolia/cmd/chat-bot/bot/cmdctx"
 	"github.com/JoachimFlottorp/magnolia/cmd/chat-bot/bot/execlevel"
 	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/internal/rabbitmq"
 	"github.com/JoachimFlottorp/magnolia/pkg/irc"
 	pb "github.com/JoachimFlottorp/magnolia/protobuf"
+	"github.com/rabbitmq/amqp091-go"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
 )
@@ -39,6 +42,7 @@ type bot struct {
 	irc         *irc.IrcConnection
 	prefix      string
 	admins      []string
+	channels    []string
 }
 
 func NewBot(ctx ctx.Context, creds Credentials) (Bot, error) {
@@ -52,71 +56,58 @@ func NewBot(ctx ctx.Context, creds Credentials) (Bot, error) {
 
 	i := irc.NewClient(creds.Username, creds.Password)
 
+	if address := ctx.Config().Twitch.Address; address != "" {
+		i.Address = address
+	}
+
 	b := &bot{
 		ctx:         ctx,
 		credentials: creds,
 		irc:         i,
 		prefix:      ctx.Config().Twitch.Bot.Prefix,
 		admins:      ctx.Config().Twitch.Bot.Admins,
+		channels:    ctx.Config().Twitch.Bot.Channels,
 	}
 
 	return b, nil
 }
 
 func (b *bot) Run() error {
+	b.irc.OnStateChange(func(state irc.ConnectionState) {
+		zap.S().Infow("Chat-bot connection changed state", "state", state)
+	})
+
 	if err := b.irc.Connect(); err != nil {
 		return err
 	}
 
 	b.setupCommands()
 
-	go func() {
-		newMsg, err := b.ctx.Inst().Redis.Subscribe(b.ctx, "twitch:messages")
-		if err != nil {
-			zap.S().Errorw("Failed to subscribe to twitch:messages", "error", err)
-			return
-		}
+	newMsg, err := b.consumeMessages()
+	if err != nil {
+		return err
+	}
 
+	go func() {
 		for {
 			select {
 			case <-b.ctx.Done():
 				{
 					return
 				}
-			case rawMsg := <-newMsg:
+			case delivery, ok := <-newMsg:
 				{
-					msg := &pb.IRCPrivmsg{}
-					if err := proto.Unmarshal([]byte(rawMsg), msg); err != nil {
-						zap.S().Errorw("Failed to unmarshal message", "error", err)
-						continue
-					}
-
-					if !strings.HasPrefix(msg.Message, b.prefix) {
-						continue
-					}
-
-					commandName, args := cleanInput(b.prefix, msg.Message)
-					if commandName == "" {
-						continue
-					}
-
-					execLevel := getExec(b.admins, msg.User.UserId)
-
-					ok, command := CanExecute(commandName, execLevel)
 					if !ok {
-						continue
+						zap.S().Errorw("Stopped receiving chat messages", "queue", rabbitmq.QueueChatBotMessages)
+						return
 					}
 
-					ctx := cmdctx.NewContext(b.ctx, msg)
+					b.onMessage(delivery.Body)
 
-					if err := command.Execute(ctx, b, args); err != nil {
-						zap.S().Errorw("Failed to execute command", "error", err)
-						b.Say(ctx.Channel(), "Something bad happened FeelsDankMan")
-						continue
+					// Acknowledged once handled, a message the bot did not get to before stopping is delivered again
+					if err := delivery.Ack(false); err != nil {
+						zap.S().Errorw("Failed to acknowledge message", "error", err)
 					}
-
-					zap.S().Infow("Executed command", "command", commandName, "args", args)
-					continue
 				}
 			}
 		}
@@ -125,6 +116,96 @@ func (b *bot) Run() error {
 	return nil
 }
 
+// consumeMessages binds the bot's queue to the channels it reads commands in
+func (b *bot) consumeMessages() (chan *amqp091.Delivery, error) {
+	rmq := b.ctx.Inst().RMQ
+
+	if err := rmq.CreateExchange(b.ctx, rabbitmq.ExchangeSettings{
+		Name: rabbitmq.ExchangeTwitchMessages,
+		Type: rabbitmq.ExchangeTypeTopic,
+	}); err != nil {
+		return nil, err
+	}
+
+	if _, err := rmq.CreateQueue(b.ctx, rabbitmq.QueueSettings{
+		Name: rabbitmq.QueueChatBotMessages,
+	}); err != nil {
+		return nil, err
+	}
+
+	keys := []string{rabbitmq.TwitchMessageKey("*")}
+	if len(b.channels) > 0 {
+		keys = make([]string, len(b.channels))
+		for i, channel := range b.channels {
+			keys[i] = rabbitmq.TwitchMessageKey(strings.ToLower(channel))
+		}
+	}
+
+	for _, key := range keys {
+		if err := rmq.BindQueue(b.ctx, rabbitmq.BindingSettings{
+			Name:       rabbitmq.QueueChatBotMessages.String(),
+			RoutingKey: key,
+			Exchange:   rabbitmq.ExchangeTwitchMessages,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return rmq.Consume(b.ctx, rabbitmq.ConsumeSettings{
+		Queue:     rabbitmq.QueueChatBotMessages,
+		ManualAck: true,
+	})
+}
+
+func (b *bot) onMessage(raw []byte) {
+	msg := &pb.IRCPrivmsg{}
+	if err := proto.Unmarshal(raw, msg); err != nil {
+		zap.S().Errorw("Failed to unmarshal message", "error", err)
+		return
+	}
+
+	// Bindings of channels which were removed from the config stay on the queue
+	if len(b.channels) > 0 && !b.readsChannel(msg.Channel) {
+		return
+	}
+
+	if !strings.HasPrefix(msg.Message, b.prefix) {
+		return
+	}
+
+	commandName, args := cleanInput(b.prefix, msg.Message)
+	if commandName == "" {
+		return
+	}
+
+	execLevel := getExec(b.admins, msg.User.UserId)
+
+	ok, command := CanExecute(commandName, execLevel)
+	if !ok {
+		return
+	}
+
+	ctx := cmdctx.NewContext(b.ctx, msg)
+
+	if err := command.Execute(ctx, b, args); err != nil {
+		zap.S().Errorw("Failed to execute command", "error", err)
+		b.Say(ctx.Channel(), "Something bad happened FeelsDankMan")
+		return
+	}
+
+	zap.S().Infow("Executed command", "command", commandName, "args", args)
+}
+
+func (b *bot) readsChannel(channel string) bool {
+	for _, c := range b.channels {
+		if strings.EqualFold(c, channel) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (b *bot) Stop() error {
 	return b.irc.Disconnect()
 }
@@ -146,6 +227,9 @@ func (b *bot) setupCommands() {
 
 	leaveCommand := newLeaveCommand(b.ctx)
 	commands[leaveCommand.Name()] = leaveCommand
+
+	ignoreBotCommand := newIgnoreBotCommand(b.ctx)
+	commands[ignoreBotCommand.Name()] = ignoreBotCommand
 }
 
 func cleanInput(prefix, input string) (command string, args []string) {
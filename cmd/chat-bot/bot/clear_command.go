@@ -1,11 +1,11 @@
 package bot
 
 import (
-	"fmt"
 	"strings"
 
 	"github.com/JoachimFlottorp/magnolia/cmd/chat-bot/bot/cmdctx"
 	"github.com/JoachimFlottorp/magnolia/cmd/chat-bot/bot/execlevel"
+	"github.com/JoachimFlottorp/magnolia/internal/chatdata"
 	"github.com/JoachimFlottorp/magnolia/internal/ctx"
 )
 
@@ -37,9 +37,7 @@ func (c clearCommand) Execute(ctx cmdctx.Context, b Bot, args []string) error {
 	channel = strings.Replace(channel, "$this", ctx.Channel(), -1)
 	channel = strings.ToLower(channel)
 
-	key := fmt.Sprintf("twitch:%s:chat-data", channel)
-
-	err := c.Ctx.Inst().Redis.Del(c.Ctx, key)
+	err := chatdata.Purge(c.Ctx, c.Ctx.Inst().Redis, channel)
 	if err != nil {
 		b.Say(ctx.Channel(), "Failed to clear chat data FeelsDankMan")
 		return err
@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"strings"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/cmd/chat-bot/bot/cmdctx"
+	"github.com/JoachimFlottorp/magnolia/cmd/chat-bot/bot/execlevel"
+	"github.com/JoachimFlottorp/magnolia/internal/botlist"
+	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/internal/mongo"
+)
+
+type ignoreBotCommand struct {
+	Ctx ctx.Context
+}
+
+func newIgnoreBotCommand(gCtx ctx.Context) Command {
+	return ignoreBotCommand{
+		Ctx: gCtx,
+	}
+}
+
+func (c ignoreBotCommand) Name() string {
+	return "ignorebot"
+}
+
+func (c ignoreBotCommand) ExecutionLevel() execlevel.ExecutionLevel {
+	return execlevel.ExecutionLevelAdmin
+}
+
+func (c ignoreBotCommand) Execute(ctx cmdctx.Context, b Bot, args []string) error {
+	if len(args) < 2 || (args[0] != "add" && args[0] != "remove") {
+		b.Say(ctx.Channel(), "Usage: ignorebot add|remove <username> FeelsDankMan")
+		return nil
+	}
+
+	bot := mongo.IgnoredBot{
+		Name:    strings.ToLower(strings.TrimPrefix(args[1], "@")),
+		AddedBy: ctx.Prompter(),
+		AddedAt: time.Now(),
+	}
+
+	var err error
+	if args[0] == "add" {
+		err = bot.Save(c.Ctx, c.Ctx.Inst().Mongo)
+	} else {
+		err = bot.Remove(c.Ctx, c.Ctx.Inst().Mongo)
+	}
+
+	if err != nil {
+		b.Say(ctx.Channel(), "Error FeelsDankMan")
+		return err
+	}
+
+	if err := botlist.Invalidate(c.Ctx, c.Ctx.Inst().Redis); err != nil {
+		return err
+	}
+
+	b.Say(ctx.Channel(), "ok, the readers pick it up within 10 minutes FeelsDankMan")
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/pkg/irc"
+	"github.com/google/uuid"
+)
+
+const (
+	FORMAT_AUTO    = "auto"
+	FORMAT_RAW     = "raw"
+	FORMAT_JSONL   = "jsonl"
+	FORMAT_JUSTLOG = "justlog"
+
+	// ANONYMOUS_USER is used for records which do not say who sent them
+	ANONYMOUS_USER = "anonymous"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown format")
+	ErrNoChannel     = errors.New("record has no channel, use -channel")
+
+	// [2023-01-02 15:04:05] #forsen forsen: AlienPls, the channel is left out in logs of a single user
+	justlogPattern = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})\] (?:#(\w+) )?(\w+): (.*)$`)
+)
+
+// jsonlRecord reads the files written by the jsonl sink, user fields are optional
+type jsonlRecord struct {
+	Channel string `json:"channel"`
+	ID      string `json:"id"`
+	Text    string `json:"text"`
+	// Timestamp is in milliseconds
+	Timestamp int64  `json:"ts"`
+	User      string `json:"user"`
+	UserID    string `json:"user_id"`
+}
+
+// scanMessages calls fn for every chat message in r, lines which are not chat messages are skipped.
+//
+// channel is used for records which do not say which channel they are from.
+func scanMessages(r io.Reader, format string, channel string, fn func(msg *irc.PrivmsgMessage) error) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	skipped := 0
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		lineFormat := format
+		if lineFormat == FORMAT_AUTO {
+			lineFormat = detectFormat(line)
+		}
+
+		msg, err := parseRecord(line, lineFormat, channel)
+		if err != nil {
+			return skipped, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		if msg == nil {
+			skipped++
+			continue
+		}
+
+		if err := fn(msg); err != nil {
+			return skipped, err
+		}
+	}
+
+	return skipped, scanner.Err()
+}
+
+func detectFormat(line string) string {
+	switch line[0] {
+	case '{':
+		return FORMAT_JSONL
+	case '[':
+		return FORMAT_JUSTLOG
+	default:
+		return FORMAT_RAW
+	}
+}
+
+// parseRecord returns nil for lines which are not chat messages
+func parseRecord(line, format, channel string) (*irc.PrivmsgMessage, error) {
+	switch format {
+	case FORMAT_RAW:
+		{
+			msg, err := irc.ParseLine(line)
+			if err != nil {
+				return nil, nil
+			}
+
+			privmsg, ok := msg.(*irc.PrivmsgMessage)
+			if !ok {
+				return nil, nil
+			}
+
+			return privmsg, nil
+		}
+	case FORMAT_JSONL:
+		{
+			var record jsonlRecord
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				return nil, err
+			}
+
+			if record.Text == "" {
+				return nil, nil
+			}
+
+			if record.Channel == "" {
+				record.Channel = channel
+			}
+
+			return synthesize(record)
+		}
+	case FORMAT_JUSTLOG:
+		{
+			match := justlogPattern.FindStringSubmatch(line)
+			if match == nil {
+				return nil, nil
+			}
+
+			ts, err := time.Parse("2006-01-02 15:04:05", match[1])
+			if err != nil {
+				return nil, err
+			}
+
+			record := jsonlRecord{
+				Channel:   match[2],
+				User:      match[3],
+				Text:      match[4],
+				Timestamp: ts.UnixMilli(),
+			}
+
+			if record.Channel == "" {
+				record.Channel = channel
+			}
+
+			return synthesize(record)
+		}
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// synthesize builds the IRC line Twitch would have sent for the record,
+// so every format goes through the same parsing as live chat.
+func synthesize(record jsonlRecord) (*irc.PrivmsgMessage, error) {
+	if record.Channel == "" {
+		return nil, ErrNoChannel
+	}
+
+	if record.ID == "" {
+		record.ID = uuid.NewString()
+	}
+
+	if record.User == "" {
+		record.User = ANONYMOUS_USER
+	}
+
+	user := strings.ToLower(record.User)
+	text := strings.NewReplacer("\r", " ", "\n", " ").Replace(record.Text)
+
+	tags := fmt.Sprintf("@display-name=%s;id=%s;user-id=%s", record.User, record.ID, record.UserID)
+	if record.Timestamp > 0 {
+		tags += ";tmi-sent-ts=" + strconv.FormatInt(record.Timestamp, 10)
+	}
+
+	line := fmt.Sprintf("%s :%s!%s@%s.tmi.twitch.tv PRIVMSG #%s :%s", tags, user, user, user, strings.ToLower(record.Channel), text)
+
+	msg, err := irc.ParseLine(line)
+	if err != nil {
+		return nil, err
+	}
+
+	privmsg, ok := msg.(*irc.PrivmsgMessage)
+	if !ok {
+		return nil, fmt.Errorf("not a chat message: %q", line)
+	}
+
+	return privmsg, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JoachimFlottorp/magnolia/pkg/irc"
+)
+
+func scanAll(t *testing.T, input, format, channel string) ([]*irc.PrivmsgMessage, int) {
+	t.Helper()
+
+	var messages []*irc.PrivmsgMessage
+
+	skipped, err := scanMessages(strings.NewReader(input), format, channel, func(msg *irc.PrivmsgMessage) error {
+		messages = append(messages, msg)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return messages, skipped
+}
+
+func TestScanFormats(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		Input   string
+		Format  string
+		Channel string
+		User    string
+		Text    string
+		TS      int64
+		ID      string
+	}{
+		{
+			Name:   "raw",
+			Input:  "@id=abc;tmi-sent-ts=1672671845000;user-id=22484632 :forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :AlienPls",
+			Format: FORMAT_RAW,
+			User:   "forsen",
+			Text:   "AlienPls",
+			TS:     1672671845000,
+			ID:     "abc",
+		},
+		{
+			Name:   "jsonl",
+			Input:  `{"channel":"forsen","id":"abc","text":"AlienPls","ts":1672671845000}`,
+			Format: FORMAT_JSONL,
+			User:   ANONYMOUS_USER,
+			Text:   "AlienPls",
+			TS:     1672671845000,
+			ID:     "abc",
+		},
+		{
+			Name:   "justlog",
+			Input:  "[2023-01-02 15:04:05] #forsen forsen: AlienPls forsenE",
+			Format: FORMAT_JUSTLOG,
+			User:   "forsen",
+			Text:   "AlienPls forsenE",
+			TS:     1672671845000,
+		},
+		{
+			Name:    "justlog of a single user",
+			Input:   "[2023-01-02 15:04:05] forsen: AlienPls",
+			Format:  FORMAT_JUSTLOG,
+			Channel: "forsen",
+			User:    "forsen",
+			Text:    "AlienPls",
+			TS:      1672671845000,
+		},
+	}
+
+	for _, testCase := range testCases {
+		for _, format := range []string{testCase.Format, FORMAT_AUTO} {
+			t.Run(testCase.Name+"/"+format, func(t *testing.T) {
+				messages, _ := scanAll(t, testCase.Input, format, testCase.Channel)
+				if len(messages) != 1 {
+					t.Fatalf("got %d messages, want 1", len(messages))
+				}
+
+				msg := messages[0]
+
+				if msg.Channel != "forsen" || msg.User != testCase.User || msg.Message != testCase.Text {
+					t.Errorf("got channel %q, user %q and text %q", msg.Channel, msg.User, msg.Message)
+				}
+
+				if got := msg.Timestamp().UnixMilli(); got != testCase.TS {
+					t.Errorf("got timestamp %d, want %d", got, testCase.TS)
+				}
+
+				if testCase.ID != "" && msg.ID() != testCase.ID {
+					t.Errorf("got id %q, want %q", msg.ID(), testCase.ID)
+				}
+
+				if msg.ID() == "" {
+					t.Errorf("message has no id")
+				}
+			})
+		}
+	}
+}
+
+func TestScanSkipsOtherLines(t *testing.T) {
+	input := strings.Join([]string{
+		":tmi.twitch.tv 001 justinfan123 :Welcome, GLHF!",
+		"@id=abc :forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :AlienPls",
+		"",
+		"[2023-01-02 15:04:05] #forsen forsen has been timed out for 10 seconds",
+	}, "\n")
+
+	messages, skipped := scanAll(t, input, FORMAT_AUTO, "")
+
+	if len(messages) != 1 || skipped != 2 {
+		t.Errorf("got %d messages and %d skipped, want 1 and 2", len(messages), skipped)
+	}
+}
+
+func TestScanNeedsChannel(t *testing.T) {
+	_, err := scanMessages(strings.NewReader("[2023-01-02 15:04:05] forsen: AlienPls"), FORMAT_JUSTLOG, "", func(msg *irc.PrivmsgMessage) error {
+		return nil
+	})
+
+	if err == nil {
+		t.Errorf("got no error for a record without a channel")
+	}
+}
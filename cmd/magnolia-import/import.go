@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/cmd/twitch-reader/filter"
+	"github.com/JoachimFlottorp/magnolia/cmd/twitch-reader/sink"
+	"github.com/JoachimFlottorp/magnolia/external"
+	"github.com/JoachimFlottorp/magnolia/internal/botlist"
+	"github.com/JoachimFlottorp/magnolia/internal/chatdata"
+	"github.com/JoachimFlottorp/magnolia/internal/config"
+	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/internal/mongo"
+	"github.com/JoachimFlottorp/magnolia/pkg/irc"
+	"go.uber.org/zap"
+)
+
+// importer writes recorded messages through the filters and sinks of the twitch-reader
+type importer struct {
+	ctx     ctx.Context
+	filters *filter.Pipeline
+	sinks   []sink.Sink
+
+	defaultLimit int64
+	limits       map[string]int64
+
+	imported map[string]int
+	dropped  map[string]int
+}
+
+func runImport(conf *config.Config, files []string, names []string) error {
+	gCtx, cancel, err := ctx.CreateAndPopulateGlobalContext(conf)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	readerConf := conf.Twitch.Reader
+
+	bots := botlist.New()
+	if err := botlist.NewRefresher(gCtx, bots, readerConf.Filter.Bots, external.Client()).Refresh(); err != nil {
+		zap.S().Warnw("Failed to load bot list, only the configured bots are filtered", "error", err)
+
+		bots.Set(readerConf.Filter.Bots)
+	}
+
+	filters, err := filter.New(readerConf.Filter, readerConf.ChannelFilters, bots)
+	if err != nil {
+		return err
+	}
+
+	imp := &importer{
+		ctx:          gCtx,
+		filters:      filters,
+		defaultLimit: readerConf.Retention.MaxMessages,
+		limits:       make(map[string]int64),
+		imported:     make(map[string]int),
+		dropped:      make(map[string]int),
+	}
+
+	if imp.defaultLimit <= 0 {
+		imp.defaultLimit = 1000
+	}
+
+	if !*dryRun {
+		imp.sinks, err = sink.Build(gCtx, names, imp.limit)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		if err := imp.importFile(file); err != nil {
+			return err
+		}
+	}
+
+	imp.close()
+
+	for name, count := range imp.imported {
+		zap.S().Infow("Imported channel", "channel", name, "imported", count, "dropped", imp.dropped[name], "dry_run", *dryRun)
+	}
+
+	zap.S().Infow("Dropped messages", "filters", filters.Counts())
+
+	return nil
+}
+
+func (imp *importer) importFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	skipped, err := scanMessages(f, *format, *channel, imp.write)
+	if err != nil {
+		return err
+	}
+
+	zap.S().Infow("Read file", "file", path, "skipped", skipped)
+
+	return nil
+}
+
+func (imp *importer) write(msg *irc.PrivmsgMessage) error {
+	if _, ok := imp.limits[msg.Channel]; !ok {
+		imp.loadChannel(msg.Channel)
+	}
+
+	filtered := imp.filters.Drop(msg)
+	if filtered {
+		imp.dropped[msg.Channel]++
+	} else {
+		imp.imported[msg.Channel]++
+	}
+
+	ts := msg.Timestamp()
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	m := sink.Message{
+		Entry:    chatdata.NewEntry(msg.ID(), msg.Message, ts),
+		Privmsg:  msg,
+		Filtered: filtered,
+	}
+
+	for _, s := range imp.sinks {
+		if err := s.Write(imp.ctx, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadChannel uses the filters and retention stored on the channel, like the twitch-reader does
+func (imp *importer) loadChannel(name string) {
+	imp.limits[name] = imp.defaultLimit
+
+	channel := mongo.TwitchChannel{TwitchName: strings.ToLower(name)}
+	if err := channel.GetByName(imp.ctx, imp.ctx.Inst().Mongo); err != nil {
+		if err != mongo.ErrNoDocuments {
+			zap.S().Warnw("Failed to get channel settings", "channel", name, "error", err)
+		}
+
+		return
+	}
+
+	imp.filters.SetChannel(name, channel.Filter)
+
+	if channel.Retention != nil && channel.Retention.MaxMessages > 0 {
+		imp.limits[name] = channel.Retention.MaxMessages
+	}
+}
+
+func (imp *importer) limit(channel string) int64 {
+	if limit, ok := imp.limits[channel]; ok {
+		return limit
+	}
+
+	return imp.defaultLimit
+}
+
+// close flushes and closes the sinks like the twitch-reader does when it stops
+func (imp *importer) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), sink.SHUTDOWN_TIMEOUT)
+	defer cancel()
+
+	for _, s := range imp.sinks {
+		if f, ok := s.(sink.Flusher); ok {
+			if err := f.Flush(ctx); err != nil {
+				zap.S().Errorw("Failed to flush sink", "sink", s.Name(), "error", err)
+			}
+		}
+
+		if c, ok := s.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				zap.S().Errorw("Failed to close sink", "sink", s.Name(), "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// magnolia-import seeds channels with recorded chat, or replays it to a local twitch-reader.
+//
+// Files are read as raw IRC lines, JSONL like the jsonl sink writes, or justlog text logs.
+//
+//	magnolia-import -config config.toml -channel forsen forsen.log
+//	magnolia-import -replay -listen 127.0.0.1:6680 session.log
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/JoachimFlottorp/magnolia/internal/config"
+	"go.uber.org/zap"
+)
+
+var (
+	format  = flag.String("format", FORMAT_AUTO, "Format of the files, one of auto, raw, jsonl or justlog")
+	channel = flag.String("channel", "", "Channel of records which do not say which channel they are from")
+	sinks   = flag.String("sinks", "chat_data", "Comma separated sinks to write imported messages to")
+	dryRun  = flag.Bool("dry-run", false, "Only report what would be imported")
+	replay  = flag.Bool("replay", false, "Replay the files to clients of a local IRC server instead of importing them")
+	listen  = flag.String("listen", "127.0.0.1:6680", "Address the replay server listens on")
+	speed   = flag.Float64("speed", 1, "How much faster than recorded messages are replayed, 0 sends them at once")
+)
+
+func main() {
+	flag.Parse()
+
+	files := flag.Args()
+
+	if *replay {
+		if err := config.ReplaceZapGlobal(false); err != nil {
+			panic(err)
+		}
+
+		if len(files) == 0 {
+			zap.S().Fatal("No files to replay")
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer cancel()
+
+		if err := runReplay(ctx, files); err != nil {
+			zap.S().Fatalw("Failed to replay", "error", err)
+		}
+
+		return
+	}
+
+	conf, err := config.CreateConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	if len(files) == 0 {
+		zap.S().Fatal("No files to import")
+	}
+
+	if err := runImport(conf, files, strings.Split(*sinks, ",")); err != nil {
+		zap.S().Fatalw("Failed to import", "error", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/pkg/irc"
+	"github.com/JoachimFlottorp/magnolia/pkg/irc/irctest"
+	"go.uber.org/zap"
+)
+
+// runReplay serves the recorded messages on a fake Twitch IRC server until the context is done,
+// a client joining a channel gets the messages of that channel at the recorded pace.
+func runReplay(ctx context.Context, files []string) error {
+	recorded := make(map[string][]*irc.PrivmsgMessage)
+
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		_, err = scanMessages(f, *format, *channel, func(msg *irc.PrivmsgMessage) error {
+			recorded[msg.Channel] = append(recorded[msg.Channel], msg)
+			return nil
+		})
+		f.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	srv, err := irctest.Listen(*listen)
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	srv.Handler = func(c *irctest.Client, line string) bool {
+		command, args, _ := strings.Cut(line, " ")
+		if command != "JOIN" {
+			return false
+		}
+
+		for _, name := range strings.Split(args, ",") {
+			name = strings.TrimPrefix(name, "#")
+
+			if messages, ok := recorded[name]; ok {
+				go replayChannel(ctx, c, name, messages, *speed)
+			}
+		}
+
+		return false
+	}
+
+	channels := make([]string, 0, len(recorded))
+	for name := range recorded {
+		channels = append(channels, name)
+	}
+
+	zap.S().Infow("Replaying, set address in the [twitch] section of the config to the url", "url", srv.URL, "channels", channels)
+
+	<-ctx.Done()
+
+	return nil
+}
+
+func replayChannel(ctx context.Context, c *irctest.Client, name string, messages []*irc.PrivmsgMessage, speed float64) {
+	// Let the JOIN be answered before the first message arrives
+	time.Sleep(100 * time.Millisecond)
+
+	prev := messages[0].Timestamp()
+
+	for _, msg := range messages {
+		if ts := msg.Timestamp(); speed > 0 && !ts.IsZero() && !prev.IsZero() && ts.After(prev) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.Closed():
+				return
+			case <-time.After(time.Duration(float64(ts.Sub(prev)) / speed)):
+			}
+
+			prev = ts
+		}
+
+		c.Send(msg.Raw)
+	}
+
+	zap.S().Infow("Replayed channel", "channel", name, "messages", len(messages))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/external"
+	recentmessages "github.com/JoachimFlottorp/magnolia/external/recent-messages"
+	"github.com/JoachimFlottorp/magnolia/internal/chatdata"
+	"go.uber.org/zap"
+)
+
+// backfill seeds the chat data of a channel without any from recent-messages.
+//
+// The history only goes to the chat data, publishing it would have the chat-bot run old commands.
+func (r *reader) backfill(channel string) {
+	conf := r.ctx.Config().Twitch.Reader.Backfill
+	if !conf.Enabled {
+		return
+	}
+
+	rds := r.ctx.Inst().Redis
+
+	if n, err := rds.LLen(r.ctx, chatdata.Key(channel)); err != nil || n > 0 {
+		return
+	}
+
+	messages, err := recentmessages.History(r.ctx, external.Client(), conf.URL, channel, conf.Limit)
+	if err != nil {
+		zap.S().Warnw("Failed to get recent messages", "channel", channel, "error", err)
+		return
+	}
+
+	limit := r.retention.get(channel).MaxMessages
+	seeded := 0
+
+	// Oldest first, so the newest ends up at the front like live messages
+	for _, msg := range messages {
+		if r.filters.Drop(msg) {
+			continue
+		}
+
+		ts := msg.Timestamp()
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+
+		entry := chatdata.NewEntry(msg.ID(), msg.Message, ts)
+
+		if err := chatdata.Push(r.ctx, rds, channel, entry, limit); err != nil {
+			zap.S().Errorw("Failed to seed chat data", "channel", channel, "error", err)
+			return
+		}
+
+		r.tracker.Track(channel, msg.UserID(), entry.ID)
+		seeded++
+	}
+
+	zap.S().Infow("Seeded chat data from recent messages", "channel", channel, "received", len(messages), "seeded", seeded)
+}
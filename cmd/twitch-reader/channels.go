@@ -0,0 +1,238 @@
+package main
+
+import (
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/cmd/twitch-reader/filter"
+	"github.com/JoachimFlottorp/magnolia/internal/chatdata"
+	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/internal/mongo"
+	"github.com/JoachimFlottorp/magnolia/internal/rabbitmq"
+	"github.com/JoachimFlottorp/magnolia/internal/shard"
+	"github.com/JoachimFlottorp/magnolia/pkg/irc"
+	pb "github.com/JoachimFlottorp/magnolia/protobuf"
+	"github.com/rabbitmq/amqp091-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	REQUEST_JOIN = "join"
+	REQUEST_PART = "part"
+
+	// SHARD_QUEUE_EXPIRY removes the queue of a shard which is gone, it outlasts a restart so requests are not lost
+	SHARD_QUEUE_EXPIRY = 10 * time.Minute
+)
+
+// reader joins and leaves the channels owned by its shard
+type reader struct {
+	ctx       ctx.Context
+	ircMan    *irc.IrcManager
+	filters   *filter.Pipeline
+	retention *retentionPolicies
+	member    *shard.Member
+	tracker   *chatdata.Tracker
+}
+
+// applySettings uses the filters and retention stored on the channel
+func (r *reader) applySettings(channel mongo.TwitchChannel) {
+	r.filters.SetChannel(channel.TwitchName, channel.Filter)
+	r.retention.set(channel.TwitchName, channel.Retention)
+}
+
+// loadChannelSettings loads the filters and retention stored on channels
+func (r *reader) loadChannelSettings() error {
+	cursor, err := r.ctx.Inst().Mongo.Collection(mongo.CollectionTwitch).Find(r.ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"filter": bson.M{"$exists": true}},
+			bson.M{"retention": bson.M{"$exists": true}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	channels := []mongo.TwitchChannel{}
+	if err := cursor.All(r.ctx, &channels); err != nil {
+		return err
+	}
+
+	for _, channel := range channels {
+		r.applySettings(channel)
+	}
+
+	return nil
+}
+
+// syncChannels joins the channels this shard owns and leaves the ones it no longer owns
+func (r *reader) syncChannels() error {
+	cursor, err := r.ctx.Inst().Mongo.Collection(mongo.CollectionTwitch).Find(r.ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+
+	channels := []mongo.TwitchChannel{}
+	if err := cursor.All(r.ctx, &channels); err != nil {
+		return err
+	}
+
+	joined := make(map[string]bool)
+	for _, channel := range r.ircMan.Channels() {
+		joined[channel] = true
+	}
+
+	for name := range joined {
+		if !r.member.Owns(name) {
+			zap.S().Infow("Channel moved to another shard", "channel", name, "owner", r.member.Owner(name))
+
+			r.ircMan.LeaveChannel(name)
+		}
+	}
+
+	for _, channel := range channels {
+		if joined[channel.TwitchName] || !r.member.Owns(channel.TwitchName) {
+			continue
+		}
+
+		r.applySettings(channel)
+
+		go r.join(channel)
+	}
+
+	return nil
+}
+
+func (r *reader) join(channel mongo.TwitchChannel) {
+	res := r.ircMan.JoinChannel(channel.TwitchName)
+	if res != irc.JoinSuccess {
+		zap.S().Warnw("Failed to join channel", "channel", channel.TwitchName, "reason", res)
+	}
+
+	if err := channel.SetJoinStatus(r.ctx, r.ctx.Inst().Mongo, res.Error()); err != nil {
+		zap.S().Errorw("Failed to save join status", "channel", channel.TwitchName, "error", err)
+	}
+}
+
+func (r *reader) onJoinRequest(req *pb.SubChannelReq) {
+	if req.Channel == "" {
+		return
+	}
+
+	channel := mongo.TwitchChannel{
+		TwitchName: req.Channel,
+	}
+
+	if err := channel.GetByName(r.ctx, r.ctx.Inst().Mongo); err == mongo.ErrNoDocuments {
+		err = channel.ResolveByIVR(r.ctx)
+		if err != nil {
+			zap.S().Errorw("Failed to resolve channel by IVR", "error", err, "name", req.Channel)
+			return
+		}
+
+		channel.Save(r.ctx, r.ctx.Inst().Mongo)
+	}
+
+	if !r.member.Owns(channel.TwitchName) {
+		r.forward(REQUEST_JOIN, req)
+		return
+	}
+
+	r.applySettings(channel)
+
+	// Before joining, so live messages end up in front of the history
+	r.backfill(channel.TwitchName)
+
+	r.join(channel)
+}
+
+// onPartRequest deletes the channel, forwarded says it was already deleted by the shard which forwarded it
+func (r *reader) onPartRequest(req *pb.SubChannelReq, forwarded bool) {
+	if req.Channel == "" {
+		return
+	}
+
+	r.ircMan.LeaveChannel(req.Channel)
+
+	if forwarded {
+		return
+	}
+
+	_, err := r.ctx.Inst().Mongo.
+		Collection(mongo.CollectionTwitch).
+		DeleteOne(r.ctx, bson.M{
+			"twitch_name": req.Channel,
+		})
+
+	if err != nil {
+		zap.S().Errorw("Failed to delete channel from mongo", "error", err)
+	}
+
+	if !r.member.Owns(req.Channel) {
+		r.forward(REQUEST_PART, req)
+	}
+}
+
+// forward hands the request to the shard owning the channel.
+//
+// The channel is already stored in Mongo, so if the owner dies before it gets to
+// the request the shard taking over still joins it.
+func (r *reader) forward(kind string, req *pb.SubChannelReq) {
+	owner := r.member.Owner(req.Channel)
+
+	data, err := proto.Marshal(req)
+	if err != nil {
+		zap.S().Errorw("Failed to marshal protobuf message", "error", err)
+		return
+	}
+
+	err = r.ctx.Inst().RMQ.Publish(r.ctx, rabbitmq.PublishSettings{
+		Exchange:   rabbitmq.ExchangeTwitchShards,
+		RoutingKey: rabbitmq.QueueName(owner),
+		Msg: amqp091.Publishing{
+			Type:         kind,
+			Body:         data,
+			ContentType:  "application/protobuf; twitch.SubChannelReq",
+			DeliveryMode: amqp091.Persistent,
+		},
+	})
+	if err != nil {
+		zap.S().Errorw("Failed to forward request to shard", "channel", req.Channel, "shard", owner, "error", err)
+		return
+	}
+
+	zap.S().Debugw("Forwarded request to shard", "type", kind, "channel", req.Channel, "shard", owner)
+}
+
+// consumeShardQueue receives the requests other shards forwarded to this one
+func (r *reader) consumeShardQueue() (chan *amqp091.Delivery, error) {
+	rmq := r.ctx.Inst().RMQ
+	queue := rabbitmq.ShardQueue(r.member.ID())
+
+	if err := rmq.CreateExchange(r.ctx, rabbitmq.ExchangeSettings{
+		Name: rabbitmq.ExchangeTwitchShards,
+		Type: rabbitmq.ExchangeTypeDirect,
+	}); err != nil {
+		return nil, err
+	}
+
+	if _, err := rmq.CreateQueue(r.ctx, rabbitmq.QueueSettings{
+		Name:    queue,
+		Expires: SHARD_QUEUE_EXPIRY,
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := rmq.BindQueue(r.ctx, rabbitmq.BindingSettings{
+		Name:       queue.String(),
+		RoutingKey: r.member.ID(),
+		Exchange:   rabbitmq.ExchangeTwitchShards,
+	}); err != nil {
+		return nil, err
+	}
+
+	return rmq.Consume(r.ctx, rabbitmq.ConsumeSettings{
+		Queue:   queue,
+		Expires: SHARD_QUEUE_EXPIRY,
+	})
+}
@@ -0,0 +1,353 @@
+// Package filter decides which chat messages are stored as chat data.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/config"
+	"github.com/JoachimFlottorp/magnolia/pkg/irc"
+	"go.uber.org/zap"
+)
+
+// Names is every filter in the order they run unless configured otherwise
+var Names = []string{
+	"bots",
+	"verified_bots",
+	"command_prefixes",
+	"urls",
+	"length",
+	"emote_only",
+	"repeats",
+	"non_latin",
+	"banned_words",
+}
+
+// Chain runs filters in order until one drops the message
+type Chain struct {
+	filters  []Filter
+	counters *Counters
+}
+
+// Build creates the chain described by cfg, filters which are not configured are left out.
+//
+// bots is checked by the bots filter on top of the configured names, it may be nil.
+func Build(cfg config.FilterConfig, bots NameSet, counters *Counters) (*Chain, error) {
+	built := make(map[string]Filter)
+
+	pattern := DefaultBotPattern
+	if cfg.BotPattern != "" {
+		p, err := regexp.Compile(cfg.BotPattern)
+		if err != nil {
+			return nil, fmt.Errorf("bot_pattern: %w", err)
+		}
+
+		pattern = p
+	}
+
+	names := make(map[string]bool, len(cfg.Bots))
+	for _, bot := range cfg.Bots {
+		names[strings.ToLower(bot)] = true
+	}
+
+	built["bots"] = &botFilter{names, pattern, bots}
+
+	if cfg.VerifiedBots != nil && *cfg.VerifiedBots {
+		built["verified_bots"] = verifiedBotFilter{}
+	}
+
+	if len(cfg.CommandPrefixes) > 0 {
+		built["command_prefixes"] = prefixFilter{cfg.CommandPrefixes}
+	}
+
+	if cfg.URLs != nil && *cfg.URLs {
+		built["urls"] = urlFilter{}
+	}
+
+	if min, max := value(cfg.MinLength), value(cfg.MaxLength); min > 0 || max > 0 {
+		built["length"] = lengthFilter{min, max}
+	}
+
+	if cfg.EmoteOnly != nil && *cfg.EmoteOnly {
+		built["emote_only"] = emoteOnlyFilter{}
+	}
+
+	if window := value(cfg.RepeatWindow); window > 0 {
+		built["repeats"] = &repeatFilter{
+			window: time.Duration(window) * time.Second,
+			last:   make(map[string]repeatedMessage),
+		}
+	}
+
+	if max := value(cfg.MaxNonLatin); max > 0 {
+		built["non_latin"] = nonLatinFilter{max}
+	}
+
+	if len(cfg.BannedWords) > 0 {
+		words := make([]string, 0, len(cfg.BannedWords))
+		for _, word := range cfg.BannedWords {
+			if word != "" {
+				words = append(words, bannedWordPattern(word))
+			}
+		}
+
+		if len(words) > 0 {
+			built["banned_words"] = bannedWordFilter{regexp.MustCompile(`(?i)(?:` + strings.Join(words, "|") + `)`)}
+		}
+	}
+
+	order := make([]string, 0, len(Names))
+	seen := make(map[string]bool, len(Names))
+
+	for _, name := range append(append([]string{}, cfg.Order...), Names...) {
+		if seen[name] {
+			continue
+		}
+
+		if !isKnown(name) {
+			return nil, fmt.Errorf("order: unknown filter %q", name)
+		}
+
+		seen[name] = true
+		order = append(order, name)
+	}
+
+	c := &Chain{
+		filters:  make([]Filter, 0, len(built)),
+		counters: counters,
+	}
+
+	for _, name := range order {
+		if f, ok := built[name]; ok {
+			c.filters = append(c.filters, f)
+		}
+	}
+
+	return c, nil
+}
+
+// value returns what a threshold is set to, unset is 0 which disables it
+func value[T int | float64](p *T) T {
+	if p == nil {
+		return 0
+	}
+
+	return *p
+}
+
+// bannedWordPattern matches the word on its own. An end with a word character is bounded by \b,
+// which never matches next to symbols, so an end like the ) of :) is bounded by whitespace or punctuation.
+func bannedWordPattern(word string) string {
+	const (
+		before = `(?:^|[\s\pP\pS])`
+		after  = `(?:[\s\pP\pS]|$)`
+	)
+
+	pattern := regexp.QuoteMeta(word)
+
+	if isWordByte(word[0]) {
+		pattern = `\b` + pattern
+	} else {
+		pattern = before + pattern
+	}
+
+	if isWordByte(word[len(word)-1]) {
+		pattern += `\b`
+	} else {
+		pattern += after
+	}
+
+	return pattern
+}
+
+// isWordByte reports if the byte is a character \b counts as part of a word
+func isWordByte(b byte) bool {
+	return b == '_' || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+func isKnown(name string) bool {
+	for _, known := range Names {
+		if known == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Drop reports if the message should not be stored, and counts which filter dropped it.
+func (c *Chain) Drop(msg *irc.PrivmsgMessage) bool {
+	for _, f := range c.filters {
+		if f.Drop(msg) {
+			c.counters.inc(f.Name())
+			return true
+		}
+	}
+
+	return false
+}
+
+// Merge returns base with every setting in override applied on top.
+//
+// Lists of bots and banned words are added to, everything else is replaced when set,
+// so a threshold set to 0 disables the one in base.
+func Merge(base config.FilterConfig, override config.FilterConfig) config.FilterConfig {
+	merged := base
+
+	merged.Bots = append(append([]string{}, base.Bots...), override.Bots...)
+	merged.BannedWords = append(append([]string{}, base.BannedWords...), override.BannedWords...)
+
+	if len(override.Order) > 0 {
+		merged.Order = override.Order
+	}
+	if override.BotPattern != "" {
+		merged.BotPattern = override.BotPattern
+	}
+	if override.VerifiedBots != nil {
+		merged.VerifiedBots = override.VerifiedBots
+	}
+	if len(override.CommandPrefixes) > 0 {
+		merged.CommandPrefixes = override.CommandPrefixes
+	}
+	if override.URLs != nil {
+		merged.URLs = override.URLs
+	}
+	if override.MinLength != nil {
+		merged.MinLength = override.MinLength
+	}
+	if override.MaxLength != nil {
+		merged.MaxLength = override.MaxLength
+	}
+	if override.EmoteOnly != nil {
+		merged.EmoteOnly = override.EmoteOnly
+	}
+	if override.RepeatWindow != nil {
+		merged.RepeatWindow = override.RepeatWindow
+	}
+	if override.MaxNonLatin != nil {
+		merged.MaxNonLatin = override.MaxNonLatin
+	}
+
+	return merged
+}
+
+// Counters counts how many messages each filter dropped
+type Counters struct {
+	mtx    sync.Mutex
+	counts map[string]int64
+}
+
+func NewCounters() *Counters {
+	return &Counters{
+		counts: make(map[string]int64),
+	}
+}
+
+func (c *Counters) inc(name string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.counts[name]++
+}
+
+// Snapshot returns the counts so far
+func (c *Counters) Snapshot() map[string]int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	snapshot := make(map[string]int64, len(c.counts))
+	for name, count := range c.counts {
+		snapshot[name] = count
+	}
+
+	return snapshot
+}
+
+// Pipeline picks the chain of each channel, the global filters merged with the channel's own.
+type Pipeline struct {
+	global   config.FilterConfig
+	channels map[string]config.FilterConfig
+	bots     NameSet
+	counters *Counters
+
+	mtx       sync.Mutex
+	overrides map[string]*config.FilterConfig
+	chains    map[string]*Chain
+	fallback  *Chain
+}
+
+// New creates the pipeline from the configured global and per channel filters.
+func New(global config.FilterConfig, channels map[string]config.FilterConfig, bots NameSet) (*Pipeline, error) {
+	counters := NewCounters()
+
+	fallback, err := Build(global, bots, counters)
+	if err != nil {
+		return nil, err
+	}
+
+	if channels == nil {
+		channels = make(map[string]config.FilterConfig)
+	}
+
+	return &Pipeline{
+		global:    global,
+		channels:  channels,
+		bots:      bots,
+		counters:  counters,
+		overrides: make(map[string]*config.FilterConfig),
+		chains:    make(map[string]*Chain),
+		fallback:  fallback,
+	}, nil
+}
+
+// SetChannel sets the filters stored for the channel, which apply on top of the configured ones.
+func (p *Pipeline) SetChannel(channel string, cfg *config.FilterConfig) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if cfg == nil {
+		delete(p.overrides, channel)
+	} else {
+		p.overrides[channel] = cfg
+	}
+
+	delete(p.chains, channel)
+}
+
+func (p *Pipeline) chain(channel string) *Chain {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if c, ok := p.chains[channel]; ok {
+		return c
+	}
+
+	cfg := Merge(p.global, p.channels[channel])
+	if override, ok := p.overrides[channel]; ok {
+		cfg = Merge(cfg, *override)
+	}
+
+	c, err := Build(cfg, p.bots, p.counters)
+	if err != nil {
+		zap.S().Errorw("Invalid filters for channel, using the global ones", "channel", channel, "error", err)
+
+		c = p.fallback
+	}
+
+	p.chains[channel] = c
+
+	return c
+}
+
+// Drop reports if the message should not be stored
+func (p *Pipeline) Drop(msg *irc.PrivmsgMessage) bool {
+	return p.chain(msg.Channel).Drop(msg)
+}
+
+// Counts returns how many messages each filter dropped
+func (p *Pipeline) Counts() map[string]int64 {
+	return p.counters.Snapshot()
+}
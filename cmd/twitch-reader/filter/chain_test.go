@@ -0,0 +1,248 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/config"
+	"github.com/JoachimFlottorp/magnolia/pkg/irc"
+)
+
+func privmsg(t *testing.T, line string) *irc.PrivmsgMessage {
+	t.Helper()
+
+	msg, err := irc.ParseLine(line)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", line, err)
+	}
+
+	return msg.(*irc.PrivmsgMessage)
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func floatPtr(n float64) *float64 {
+	return &n
+}
+
+func TestChain(t *testing.T) {
+	yes := true
+
+	counters := NewCounters()
+	chain, err := Build(config.FilterConfig{
+		Bots:            []string{"Fossabot"},
+		VerifiedBots:    &yes,
+		CommandPrefixes: []string{"!", "$"},
+		URLs:            &yes,
+		MinLength:       intPtr(3),
+		MaxLength:       intPtr(20),
+		EmoteOnly:       &yes,
+		RepeatWindow:    intPtr(30),
+		MaxNonLatin:     floatPtr(0.5),
+		BannedWords:     []string{"forsenE"},
+	}, nil, counters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		Line string
+		Drop bool
+	}{
+		{":forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :hello chat", false},
+		{":fossabot!fossabot@fossabot.tmi.twitch.tv PRIVMSG #forsen :hello chat", true},
+		{":supibot!supibot@supibot.tmi.twitch.tv PRIVMSG #forsen :hello chat", true},
+		{"@badges=bot-badge/1 :someone!someone@someone.tmi.twitch.tv PRIVMSG #forsen :hello chat", true},
+		{":forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :!ping", true},
+		{":forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :look https://x.com", true},
+		{":forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :go to forsen.tv", true},
+		{":forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :hi", true},
+		{":forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :this message is far too long", true},
+		{"@emote-only=1;emotes=25:0-4 :forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :Kappa", true},
+		{":forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :hello chat", true},
+		{":forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :привет чат", true},
+		{":forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :ok forsenE ok", true},
+		{":forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :ok forsenEE", false},
+	}
+
+	for _, testCase := range testCases {
+		if got := chain.Drop(privmsg(t, testCase.Line)); got != testCase.Drop {
+			t.Errorf("%s: got %v, want %v", testCase.Line, got, testCase.Drop)
+		}
+	}
+
+	counts := counters.Snapshot()
+	for name, want := range map[string]int64{
+		"bots":             2,
+		"verified_bots":    1,
+		"command_prefixes": 1,
+		"urls":             2,
+		"length":           2,
+		"emote_only":       1,
+		"repeats":          1,
+		"non_latin":        1,
+		"banned_words":     1,
+	} {
+		if counts[name] != want {
+			t.Errorf("%s: got %d drops, want %d", name, counts[name], want)
+		}
+	}
+}
+
+func TestBannedWordBoundaries(t *testing.T) {
+	chain, err := Build(config.FilterConfig{BannedWords: []string{":)", "@@", "forsenE"}}, nil, NewCounters())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		Message string
+		Drop    bool
+	}{
+		{":)", true},
+		{"hello :)", true},
+		{"hello :) chat", true},
+		{"hello,:)!", true},
+		{"hello:)", false},
+		{"@@ hello", true},
+		{"@@hello", false},
+		{"FORSENE", true},
+		{"forsenE!", true},
+		{"forsenE, chat", true},
+		{"(forsenE)", true},
+		{"forsenE's", true},
+		{"forsenEE", false},
+		{"xforsenE", false},
+	}
+
+	for _, testCase := range testCases {
+		line := ":x!x@x.tmi.twitch.tv PRIVMSG #forsen :" + testCase.Message
+		if got := chain.Drop(privmsg(t, line)); got != testCase.Drop {
+			t.Errorf("%s: got %v, want %v", testCase.Message, got, testCase.Drop)
+		}
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	counters := NewCounters()
+	chain, err := Build(config.FilterConfig{
+		Order:           []string{"length", "command_prefixes"},
+		CommandPrefixes: []string{"!"},
+		MinLength:       intPtr(5),
+	}, nil, counters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain.Drop(privmsg(t, ":forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :!xd"))
+
+	if got := counters.Snapshot()["length"]; got != 1 {
+		t.Errorf("got %d drops by length, want it to run first", got)
+	}
+
+	if _, err := Build(config.FilterConfig{Order: []string{"xd"}}, nil, counters); err == nil {
+		t.Errorf("got no error for an unknown filter")
+	}
+}
+
+type nameSet map[string]bool
+
+func (n nameSet) Has(name string) bool {
+	return n[name]
+}
+
+func TestSharedBotList(t *testing.T) {
+	chain, err := Build(config.FilterConfig{}, nameSet{"okayeg": true, "streamlabs": true}, NewCounters())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !chain.Drop(privmsg(t, ":okayeg!okayeg@okayeg.tmi.twitch.tv PRIVMSG #forsen :hello")) {
+		t.Errorf("got kept, want the shared list to drop okayeg")
+	}
+
+	if chain.Drop(privmsg(t, ":forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :hello")) {
+		t.Errorf("got dropped, want forsen kept")
+	}
+}
+
+func TestPipelineChannelFilters(t *testing.T) {
+	p, err := New(config.FilterConfig{
+		CommandPrefixes: []string{"!"},
+		Bots:            []string{"a"},
+	}, map[string]config.FilterConfig{
+		"forsen": {CommandPrefixes: []string{"$"}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.SetChannel("forsen", &config.FilterConfig{Bots: []string{"b"}})
+
+	testCases := []struct {
+		Line string
+		Drop bool
+	}{
+		{":x!x@x.tmi.twitch.tv PRIVMSG #pajlada :!ping", true},
+		{":x!x@x.tmi.twitch.tv PRIVMSG #pajlada :$ping", false},
+		{":x!x@x.tmi.twitch.tv PRIVMSG #forsen :!ping", false},
+		{":x!x@x.tmi.twitch.tv PRIVMSG #forsen :$ping", true},
+		{":a!a@a.tmi.twitch.tv PRIVMSG #forsen :hello", true},
+		{":b!b@b.tmi.twitch.tv PRIVMSG #forsen :hello", true},
+		{":b!b@b.tmi.twitch.tv PRIVMSG #pajlada :hello", false},
+	}
+
+	for _, testCase := range testCases {
+		if got := p.Drop(privmsg(t, testCase.Line)); got != testCase.Drop {
+			t.Errorf("%s: got %v, want %v", testCase.Line, got, testCase.Drop)
+		}
+	}
+}
+
+func TestRepeatFilterForgetsUsers(t *testing.T) {
+	f := &repeatFilter{
+		window: 50 * time.Millisecond,
+		last:   make(map[string]repeatedMessage),
+	}
+
+	for _, user := range []string{"forsen", "pajlada", "forsen"} {
+		f.Drop(privmsg(t, ":"+user+"!"+user+"@"+user+".tmi.twitch.tv PRIVMSG #forsen :hello"))
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if f.Drop(privmsg(t, ":forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :hello")) {
+		t.Errorf("got dropped, want the repeat kept after the window")
+	}
+
+	if len(f.last) != 1 || len(f.sent) != 1 {
+		t.Errorf("got %d users and %d messages, want only the last one remembered", len(f.last), len(f.sent))
+	}
+}
+
+func TestMergeDisablesThresholds(t *testing.T) {
+	global := config.FilterConfig{
+		MaxLength:    intPtr(500),
+		RepeatWindow: intPtr(30),
+		MaxNonLatin:  floatPtr(0.5),
+	}
+
+	merged := Merge(global, config.FilterConfig{RepeatWindow: intPtr(0), MaxNonLatin: floatPtr(0)})
+
+	if value(merged.MaxLength) != 500 || value(merged.RepeatWindow) != 0 || value(merged.MaxNonLatin) != 0 {
+		t.Fatalf("got %+v, want max_length kept and the rest disabled", merged)
+	}
+
+	chain, err := Build(merged, nil, NewCounters())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range chain.filters {
+		if f.Name() == "repeats" || f.Name() == "non_latin" {
+			t.Errorf("got %s, want it disabled by the override", f.Name())
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/JoachimFlottorp/magnolia/pkg/irc"
+)
+
+var (
+	DefaultBotPattern = regexp.MustCompile(`bo?t{1,2}(?:(?:ard)?o|\d|_)*$|^(?:fembajs|veryhag|scriptorex|apulxd|qdc26534|linestats|pepegaboat|sierrapine|charlestonbieber|icecreamdatabase|chatvote|localaniki|rewardmore|gorenmu|0weebs|befriendlier|electricbodybuilder|o?bot(?:bear1{3}0|2465|menti|e|nextdoor)|stream(?:elements|labs))$`)
+
+	urlPattern = regexp.MustCompile(`(?i)(?:https?://|www\.)\S+|\b[a-z0-9-]+\.(?:com|net|org|tv|gg|io|me|ly|be|xyz|ru)\b`)
+)
+
+// Filter decides if a single message should not be stored
+type Filter interface {
+	Name() string
+	Drop(msg *irc.PrivmsgMessage) bool
+}
+
+// NameSet is a set of usernames, like the shared bot list
+type NameSet interface {
+	Has(name string) bool
+}
+
+type botFilter struct {
+	names   map[string]bool
+	pattern *regexp.Regexp
+	shared  NameSet
+}
+
+func (f *botFilter) Name() string {
+	return "bots"
+}
+
+func (f *botFilter) Drop(msg *irc.PrivmsgMessage) bool {
+	return f.names[msg.User] || f.pattern.MatchString(msg.User) || (f.shared != nil && f.shared.Has(msg.User))
+}
+
+type verifiedBotFilter struct{}
+
+func (f verifiedBotFilter) Name() string {
+	return "verified_bots"
+}
+
+func (f verifiedBotFilter) Drop(msg *irc.PrivmsgMessage) bool {
+	return msg.Badges().Has("bot-badge")
+}
+
+type prefixFilter struct {
+	prefixes []string
+}
+
+func (f prefixFilter) Name() string {
+	return "command_prefixes"
+}
+
+func (f prefixFilter) Drop(msg *irc.PrivmsgMessage) bool {
+	for _, prefix := range f.prefixes {
+		if strings.HasPrefix(msg.Message, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type urlFilter struct{}
+
+func (f urlFilter) Name() string {
+	return "urls"
+}
+
+func (f urlFilter) Drop(msg *irc.PrivmsgMessage) bool {
+	return urlPattern.MatchString(msg.Message)
+}
+
+type lengthFilter struct {
+	min int
+	max int
+}
+
+func (f lengthFilter) Name() string {
+	return "length"
+}
+
+func (f lengthFilter) Drop(msg *irc.PrivmsgMessage) bool {
+	length := utf8.RuneCountInString(msg.Message)
+
+	return (f.min > 0 && length < f.min) || (f.max > 0 && length > f.max)
+}
+
+type emoteOnlyFilter struct{}
+
+func (f emoteOnlyFilter) Name() string {
+	return "emote_only"
+}
+
+func (f emoteOnlyFilter) Drop(msg *irc.PrivmsgMessage) bool {
+	return msg.IsEmoteOnly()
+}
+
+// repeatFilter drops a user sending the same message again within the window
+type repeatFilter struct {
+	window time.Duration
+
+	mtx  sync.Mutex
+	last map[string]repeatedMessage
+	// sent is every message in the order they were sent, which is also the order they leave the window in
+	sent []sentMessage
+}
+
+type repeatedMessage struct {
+	text string
+	at   time.Time
+}
+
+type sentMessage struct {
+	user string
+	at   time.Time
+}
+
+func (f *repeatFilter) Name() string {
+	return "repeats"
+}
+
+func (f *repeatFilter) Drop(msg *irc.PrivmsgMessage) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	now := time.Now()
+
+	// Forget the users whose last message left the window, so users who stopped talking don't pile up
+	expired := 0
+	for _, sent := range f.sent {
+		if now.Sub(sent.at) <= f.window {
+			break
+		}
+
+		if m, ok := f.last[sent.user]; ok && m.at.Equal(sent.at) {
+			delete(f.last, sent.user)
+		}
+
+		expired++
+	}
+
+	f.sent = f.sent[expired:]
+
+	prev, ok := f.last[msg.User]
+	f.last[msg.User] = repeatedMessage{msg.Message, now}
+	f.sent = append(f.sent, sentMessage{msg.User, now})
+
+	return ok && prev.text == msg.Message && now.Sub(prev.at) <= f.window
+}
+
+type nonLatinFilter struct {
+	max float64
+}
+
+func (f nonLatinFilter) Name() string {
+	return "non_latin"
+}
+
+func (f nonLatinFilter) Drop(msg *irc.PrivmsgMessage) bool {
+	letters, nonLatin := 0, 0
+
+	for _, r := range msg.Message {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+
+		letters++
+
+		if !unicode.Is(unicode.Latin, r) {
+			nonLatin++
+		}
+	}
+
+	return letters > 0 && float64(nonLatin)/float64(letters) > f.max
+}
+
+type bannedWordFilter struct {
+	pattern *regexp.Regexp
+}
+
+func (f bannedWordFilter) Name() string {
+	return "banned_words"
+}
+
+func (f bannedWordFilter) Drop(msg *irc.PrivmsgMessage) bool {
+	return f.pattern.MatchString(msg.Message)
+}
@@ -5,27 +5,34 @@ package main
 import (
 	"context"
 	"flag"
-	"fmt"
-	"regexp"
+	"os"
 	"sync"
+	"time"
 
+	"github.com/JoachimFlottorp/magnolia/cmd/twitch-reader/filter"
+	"github.com/JoachimFlottorp/magnolia/cmd/twitch-reader/sink"
+	"github.com/JoachimFlottorp/magnolia/external"
+	"github.com/JoachimFlottorp/magnolia/internal/botlist"
+	"github.com/JoachimFlottorp/magnolia/internal/chatdata"
 	"github.com/JoachimFlottorp/magnolia/internal/config"
 	"github.com/JoachimFlottorp/magnolia/internal/ctx"
 	"github.com/JoachimFlottorp/magnolia/internal/mongo"
 	"github.com/JoachimFlottorp/magnolia/internal/rabbitmq"
+	"github.com/JoachimFlottorp/magnolia/internal/shard"
 	"github.com/JoachimFlottorp/magnolia/pkg/irc"
 	"github.com/JoachimFlottorp/magnolia/pkg/sigwrapper"
 	pb "github.com/JoachimFlottorp/magnolia/protobuf"
-	"go.mongodb.org/mongo-driver/bson"
 	"google.golang.org/protobuf/proto"
 
 	"go.uber.org/zap"
 )
 
-var (
-	maxMsg = flag.Int64("max-msg", 1000, "Maximum number of messages to store in redis")
+const (
+	DROP_REPORT_INTERVAL = 10 * time.Minute
+)
 
-	botIgnoreList = regexp.MustCompile(`bo?t{1,2}(?:(?:ard)?o|\d|_)*$|^(?:fembajs|veryhag|scriptorex|apulxd|qdc26534|linestats|pepegaboat|sierrapine|charlestonbieber|icecreamdatabase|chatvote|localaniki|rewardmore|gorenmu|0weebs|befriendlier|electricbodybuilder|o?bot(?:bear1{3}0|2465|menti|e|nextdoor)|stream(?:elements|labs))$`)
+var (
+	maxMsg = flag.Int64("max-msg", 1000, "Maximum number of messages to store in redis, used when the config has no retention")
 )
 
 func main() {
@@ -43,10 +50,89 @@ func main() {
 
 	done.Run(func(ctx context.Context) {
 
-		ircMan := irc.NewManager(gCtx)
+		readerConf := gCtx.Config().Twitch.Reader
+
+		tier, err := irc.ParseTier(readerConf.Tier)
+		if err != nil {
+			zap.S().Fatalw("Invalid twitch reader tier", "error", err)
+		}
+
+		ircMan := irc.NewManager(gCtx, irc.ManagerOptions{
+			Username: readerConf.Username,
+			Password: readerConf.Password,
+			Tier:     tier,
+			Address:  gCtx.Config().Twitch.Address,
+			JoinLimit: irc.RateLimit{
+				Count:  readerConf.JoinLimit.Count,
+				Period: time.Duration(readerConf.JoinLimit.Period) * time.Second,
+			},
+			ChannelsPerConnection: readerConf.ChannelsPerConnection,
+		})
+
+		bots := botlist.New()
+
+		filters, err := filter.New(readerConf.Filter, readerConf.ChannelFilters, bots)
+		if err != nil {
+			zap.S().Fatalw("Invalid message filters", "error", err)
+		}
+
+		defaultRetention := mongo.Retention{
+			MaxMessages: readerConf.Retention.MaxMessages,
+			MaxAge:      readerConf.Retention.MaxAge,
+		}
+		if defaultRetention.MaxMessages <= 0 {
+			defaultRetention.MaxMessages = *maxMsg
+		}
+
+		retention := newRetentionPolicies(defaultRetention)
+
+		shardID := readerConf.ShardID
+		if shardID == "" {
+			if shardID, err = os.Hostname(); err != nil {
+				zap.S().Fatalw("Failed to get hostname for the shard id", "error", err)
+			}
+		}
+
+		member := shard.NewMember(gCtx.Inst().Redis, shardID, func() int {
+			return len(ircMan.Channels())
+		})
+
+		if _, err := member.Beat(gCtx); err != nil {
+			zap.S().Fatalw("Failed to register shard", "shard", shardID, "error", err)
+		}
+
+		zap.S().Infow("Registered shard", "shard", shardID, "shards", member.Shards())
+
+		// How many messages a channel keeps in its chat data
+		maxMessages := func(channel string) int64 {
+			return retention.get(channel).MaxMessages
+		}
+
+		tracker := chatdata.NewTracker(maxMessages)
+
+		r := &reader{
+			ctx:       gCtx,
+			ircMan:    ircMan,
+			filters:   filters,
+			retention: retention,
+			member:    member,
+			tracker:   tracker,
+		}
+
+		if err := r.loadChannelSettings(); err != nil {
+			zap.S().Fatalw("Failed to load channel settings", "error", err)
+		}
 
 		wg := sync.WaitGroup{}
 
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			botlist.NewRefresher(gCtx, bots, readerConf.Filter.Bots, external.Client()).Run()
+		}()
+
 		if _, err = gCtx.Inst().RMQ.CreateQueue(ctx, rabbitmq.QueueSettings{
 			Name: rabbitmq.QueueJoinRequest,
 		}); err != nil {
@@ -76,7 +162,7 @@ func main() {
 						continue
 					}
 
-					onJoinRequest(gCtx, ircMan, req)
+					go r.onJoinRequest(req)
 				}
 			}
 		}()
@@ -105,17 +191,86 @@ func main() {
 						continue
 					}
 
-					ircMan.LeaveChannel(req.Channel)
+					r.onPartRequest(req, false)
+				}
+			}
+		}()
+
+		wg.Add(1)
 
-					_, err = gCtx.Inst().Mongo.
-						Collection(mongo.CollectionTwitch).
-						DeleteOne(gCtx, bson.M{
-							"twitch_name": req.Channel,
-						})
+		go func() {
+			defer wg.Done()
+
+			msg, err := r.consumeShardQueue()
+			if err != nil {
+				zap.S().Fatalw("Failed to consume shard queue", "error", err)
+			}
+			for {
+				select {
+				case <-gCtx.Done():
+					return
+				case m, ok := <-msg:
+					if !ok {
+						return
+					}
 
+					req := &pb.SubChannelReq{}
+					err = proto.Unmarshal(m.Body, req)
 					if err != nil {
-						zap.S().Errorw("Failed to delete channel from mongo", "error", err)
+						zap.S().Errorw("Failed to unmarshal rabbitmq message", "error", err)
+						continue
 					}
+
+					switch m.Type {
+					case REQUEST_JOIN:
+						go r.onJoinRequest(req)
+					case REQUEST_PART:
+						r.onPartRequest(req, true)
+					}
+				}
+			}
+		}()
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			member.Run(gCtx, func(shards []string) {
+				zap.S().Infow("Shards changed, moving channels", "shards", shards)
+
+				if err := r.syncChannels(); err != nil {
+					zap.S().Errorw("Failed to move channels between shards", "error", err)
+				}
+			})
+		}()
+
+		sinks, err := sink.Build(gCtx, readerConf.Sinks.Enabled, maxMessages)
+		if err != nil {
+			zap.S().Fatalw("Invalid sinks", "error", err)
+		}
+
+		fanout := sink.NewFanout(sinks, readerConf.Sinks.Buffer)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			fanout.Run(gCtx)
+		}()
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-gCtx.Done():
+					return
+				case <-time.After(DROP_REPORT_INTERVAL):
+					zap.S().Infow("Dropped messages", "filters", filters.Counts(), "sinks", fanout.Dropped())
 				}
 			}
 		}()
@@ -125,7 +280,34 @@ func main() {
 		go func() {
 			defer wg.Done()
 
-			err = ircMan.ConnectAllFromDatabase()
+			inactiveAfter := time.Duration(readerConf.Retention.InactiveAfter) * time.Second
+
+			for {
+				select {
+				case <-gCtx.Done():
+					return
+				case <-time.After(SWEEP_INTERVAL):
+					sweepChatData(gCtx, retention, inactiveAfter, member.Owns)
+				}
+			}
+		}()
+
+		clears := make(chan irc.Message, 100)
+
+		onClear := func(msg irc.Message) {
+			// Handled together with messages, so a deletion is never applied before the message it deletes
+			go func() { clears <- msg }()
+		}
+
+		ircMan.Subscribe(irc.CLEARMSG, onClear)
+		ircMan.Subscribe(irc.CLEARCHAT, onClear)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			err = r.syncChannels()
 			if err != nil {
 				zap.S().Fatalw("Failed to setup irc manager", "error", err)
 			}
@@ -134,52 +316,30 @@ func main() {
 				select {
 				case <-gCtx.Done():
 					return
+				case msg := <-clears:
+					onModeration(gCtx, tracker, fanout, msg)
 				case msg := <-ircMan.MessageQueue:
 					{
-						key := fmt.Sprintf("twitch:%s:chat-data", msg.Channel)
-						data := msg.Message
-						user := msg.User
-						if botIgnoreList.MatchString(user) {
-							continue
-						}
-
-						if len, err := gCtx.Inst().Redis.LLen(gCtx, key); err != nil {
-							zap.S().Errorw("Failed to get length of redis list", "error", err)
-							continue
-						} else {
-							if len >= *maxMsg {
-								if err := gCtx.Inst().Redis.LRPop(gCtx, key); err != nil {
-									zap.S().Errorw("Failed to pop redis list", "error", err)
-									continue
-								}
-							}
-						}
+						// Filtered messages are only kept out of storage, the chat-bot still has to see commands
+						filtered := filters.Drop(msg)
 
-						if err := gCtx.Inst().Redis.LPush(gCtx, key, data); err != nil {
-							zap.S().Errorw("Failed to push message to redis", "error", err)
-							continue
+						// Without tmi-sent-ts the entry would be dated 0001, which retention removes right away
+						ts := msg.Timestamp()
+						if ts.IsZero() {
+							ts = time.Now()
 						}
 
-						pbMsg := pb.IRCPrivmsg{
-							Message: data,
-							Channel: msg.Channel,
-							User: &pb.IRCUser{
-								Username: user,
-								UserId:   msg.UserID(),
-							},
-						}
-
-						msgByt, err := proto.Marshal(&pbMsg)
+						entry := chatdata.NewEntry(msg.ID(), msg.Message, ts)
 
-						if err != nil {
-							zap.S().Errorw("Failed to marshal protobuf message", "error", err)
-							continue
+						if !filtered {
+							tracker.Track(msg.Channel, msg.UserID(), entry.ID)
 						}
 
-						if err := gCtx.Inst().Redis.Publish(gCtx, "twitch:messages", msgByt); err != nil {
-							zap.S().Errorw("Failed to publish message to redis", "error", err)
-							continue
-						}
+						fanout.Write(sink.Message{
+							Entry:    entry,
+							Privmsg:  msg,
+							Filtered: filtered,
+						})
 					}
 				}
 			}
@@ -187,54 +347,51 @@ func main() {
 	})
 }
 
-func onJoinRequest(gCtx ctx.Context, irc *irc.IrcManager, req *pb.SubChannelReq) {
-	if req.Channel == "" {
-		return
-	}
+// onModeration removes what moderators deleted from the sinks
+func onModeration(gCtx ctx.Context, tracker *chatdata.Tracker, fanout *sink.Fanout, msg irc.Message) {
+	var (
+		channel string
+		ids     []string
+	)
+
+	switch msg := msg.(type) {
+	case *irc.ClearMsgMessage:
+		{
+			channel = msg.Channel
+			ids = []string{msg.TargetMsgID}
+		}
+	case *irc.ClearChatMessage:
+		{
+			channel = msg.Channel
 
-	channel := mongo.TwitchChannel{
-		TwitchName: req.Channel,
-	}
+			if !msg.IsFullClear() {
+				ids = tracker.Forget(channel, msg.TargetUserID)
+				break
+			}
+
+			if !gCtx.Config().Twitch.Reader.PurgeOnClear {
+				return
+			}
+
+			tracker.Clear(channel)
+
+			fanout.Moderate(gCtx, sink.Moderation{
+				Channel: channel,
+				Purge:   true,
+			})
 
-	if err := channel.GetByName(gCtx, gCtx.Inst().Mongo); err == mongo.ErrNoDocuments {
-		err = channel.ResolveByIVR(gCtx)
-		if err != nil {
-			zap.S().Errorw("Failed to resolve channel by IVR", "error", err, "name", req.Channel)
 			return
 		}
+	default:
+		return
+	}
 
-		channel.Save(gCtx, gCtx.Inst().Mongo)
+	if len(ids) == 0 {
+		return
 	}
 
-	irc.JoinChannel(channel)
+	fanout.Moderate(gCtx, sink.Moderation{
+		Channel: channel,
+		IDs:     ids,
+	})
 }
-
-// func queryUpdateBotList(ctx context.Context) {
-// 	for {
-// 		select {
-// 		case <-ctx.Done(): return
-// 		case <-time.After(1 * time.Minute): {
-// 			botList, err := supibot.GetBotList(ctx, external.Client())
-
-// 			if err != nil {
-// 				zap.S().Errorw("Failed to update bot list", "error", err)
-// 				continue
-// 			}
-
-// 			var newList []string
-// 			for _, bot := range botList.Data.Bots {
-// 				newList = append(newList, bot.Name)
-// 			}
-
-// 			newList = append(newList, ignoreBots...)
-// 			updateBotList(newList)
-
-// 			zap.S().Debugw("Updated bot list", "count", len(newList), "list", botIgnoreList.String())
-// 		}
-// 		}
-// 	}
-// }
-
-// func updateBotList(bots []string) {
-// 	botIgnoreList = regexp.MustCompile(fmt.Sprintf("(%s)", strings.Join(bots, "|")))
-// }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/chatdata"
+	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/internal/markov"
+	"github.com/JoachimFlottorp/magnolia/internal/mongo"
+	"go.uber.org/zap"
+)
+
+const (
+	SWEEP_INTERVAL = 10 * time.Minute
+)
+
+// retentionPolicies is how much chat data is kept for each channel
+type retentionPolicies struct {
+	defaults mongo.Retention
+
+	mtx      sync.Mutex
+	channels map[string]mongo.Retention
+}
+
+func newRetentionPolicies(defaults mongo.Retention) *retentionPolicies {
+	return &retentionPolicies{
+		defaults: defaults,
+		channels: make(map[string]mongo.Retention),
+	}
+}
+
+// set stores the retention of the channel, nil goes back to the defaults
+func (p *retentionPolicies) set(channel string, retention *mongo.Retention) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if retention == nil {
+		delete(p.channels, channel)
+	} else {
+		p.channels[channel] = *retention
+	}
+}
+
+func (p *retentionPolicies) get(channel string) mongo.Retention {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	r := p.defaults
+
+	if override, ok := p.channels[channel]; ok {
+		if override.MaxMessages > 0 {
+			r.MaxMessages = override.MaxMessages
+		}
+
+		if override.MaxAge > 0 {
+			r.MaxAge = override.MaxAge
+		}
+	}
+
+	return r
+}
+
+// sweepChatData applies the retention of every owned channel with chat data,
+// and deletes the chat data of channels which have been quiet for longer than inactiveAfter.
+//
+// Only the shard owning a channel knows its retention, the others leave it alone.
+func sweepChatData(gCtx ctx.Context, policies *retentionPolicies, inactiveAfter time.Duration, owns func(channel string) bool) {
+	rds := gCtx.Inst().Redis
+
+	now := time.Now()
+
+	// Scanned rather than taken from Mongo, so the chat data of channels which were parted is cleaned up too
+	err := rds.Scan(gCtx, chatdata.Key("*"), func(key string) error {
+		channel, ok := chatdata.Channel(key)
+		if ok && owns(channel) {
+			sweepChannel(gCtx, channel, policies.get(channel), inactiveAfter, now)
+		}
+
+		return nil
+	})
+	if err != nil {
+		zap.S().Errorw("Failed to list chat data", "error", err)
+	}
+}
+
+// sweepChannel deletes the chat data of the channel if it is inactive, otherwise it applies its retention
+func sweepChannel(gCtx ctx.Context, channel string, retention mongo.Retention, inactiveAfter time.Duration, now time.Time) {
+	rds := gCtx.Inst().Redis
+
+	if inactiveAfter > 0 {
+		newest, ok, err := chatdata.Newest(gCtx, rds, channel)
+		if err != nil {
+			zap.S().Errorw("Failed to get newest message", "channel", channel, "error", err)
+			return
+		}
+
+		if ok && newest.Timestamp > 0 && now.Sub(time.UnixMilli(newest.Timestamp)) > inactiveAfter {
+			if err := chatdata.Purge(gCtx, rds, channel); err != nil {
+				zap.S().Errorw("Failed to delete chat data of inactive channel", "channel", channel, "error", err)
+			} else {
+				zap.S().Infow("Deleted chat data of inactive channel", "channel", channel)
+			}
+
+			return
+		}
+	}
+
+	// Models are counted as messages come and go, the chat data from before they were has to be counted once
+	if built, err := markov.Built(gCtx, rds, channel); err != nil {
+		zap.S().Errorw("Failed to check markov model", "channel", channel, "error", err)
+	} else if !built {
+		if err := chatdata.RebuildModel(gCtx, rds, channel); err != nil {
+			zap.S().Errorw("Failed to rebuild markov model", "channel", channel, "error", err)
+		} else {
+			zap.S().Infow("Rebuilt markov model", "channel", channel)
+		}
+	}
+
+	// Catches up with a lowered limit, pushes only trim what they add to
+	if err := chatdata.Trim(gCtx, rds, channel, retention.MaxMessages); err != nil {
+		zap.S().Errorw("Failed to trim chat data", "channel", channel, "error", err)
+	}
+
+	if retention.MaxAge <= 0 {
+		return
+	}
+
+	cutoff := now.Add(-time.Duration(retention.MaxAge) * time.Second)
+
+	removed, err := chatdata.TrimOlderThan(gCtx, rds, channel, cutoff)
+	if err != nil {
+		zap.S().Errorw("Failed to trim old chat data", "channel", channel, "error", err)
+	} else if removed > 0 {
+		zap.S().Debugw("Trimmed old chat data", "channel", channel, "removed", removed)
+	}
+}
@@ -0,0 +1,101 @@
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/mongo"
+	"go.uber.org/zap"
+)
+
+const (
+	ARCHIVE_BATCH_SIZE = 500
+	// ARCHIVE_MAX_BATCH is how many messages are kept while Mongo is failing
+	ARCHIVE_MAX_BATCH = 20 * ARCHIVE_BATCH_SIZE
+)
+
+// Archive writes messages to the Mongo archive in batches
+type Archive struct {
+	inst  mongo.Instance
+	batch []mongo.ArchivedMessage
+}
+
+func NewArchive(inst mongo.Instance) *Archive {
+	return &Archive{
+		inst:  inst,
+		batch: make([]mongo.ArchivedMessage, 0, ARCHIVE_BATCH_SIZE),
+	}
+}
+
+func (s *Archive) Name() string {
+	return "archive"
+}
+
+func (s *Archive) Write(ctx context.Context, msg Message) error {
+	if msg.Filtered {
+		return nil
+	}
+
+	s.batch = append(s.batch, mongo.ArchivedMessage{
+		ChannelID: msg.Privmsg.RoomID(),
+		MsgID:     msg.Entry.ID,
+		Text:      msg.Entry.Text,
+		Timestamp: time.UnixMilli(msg.Entry.Timestamp),
+	})
+
+	// Kept messages are retried with the next full batch, not on every write
+	if len(s.batch)%ARCHIVE_BATCH_SIZE != 0 {
+		return nil
+	}
+
+	return s.Flush(ctx)
+}
+
+func (s *Archive) Flush(ctx context.Context) error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+
+	if err := mongo.ArchiveMessages(ctx, s.inst, s.batch); err != nil {
+		s.trim()
+		return err
+	}
+
+	s.batch = s.batch[:0]
+
+	return nil
+}
+
+// trim drops the oldest batch once the messages kept for a retry reach the limit
+func (s *Archive) trim() {
+	if len(s.batch) < ARCHIVE_MAX_BATCH {
+		return
+	}
+
+	zap.S().Warnw("Archive is failing, dropping the oldest messages", "dropped", ARCHIVE_BATCH_SIZE)
+
+	s.batch = s.batch[:copy(s.batch, s.batch[ARCHIVE_BATCH_SIZE:])]
+}
+
+// Moderate removes deleted messages, the archive is kept when a whole chat is cleared
+func (s *Archive) Moderate(ctx context.Context, m Moderation) error {
+	if m.Purge || len(m.IDs) == 0 {
+		return nil
+	}
+
+	deleted := make(map[string]bool, len(m.IDs))
+	for _, id := range m.IDs {
+		deleted[id] = true
+	}
+
+	// The message may still be waiting for the next flush
+	kept := s.batch[:0]
+	for _, msg := range s.batch {
+		if !deleted[msg.MsgID] {
+			kept = append(kept, msg)
+		}
+	}
+	s.batch = kept
+
+	return mongo.DeleteArchivedMessages(ctx, s.inst, m.IDs)
+}
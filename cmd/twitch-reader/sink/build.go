@@ -0,0 +1,85 @@
+package sink
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/internal/mongo"
+	"github.com/JoachimFlottorp/magnolia/internal/rabbitmq"
+)
+
+var (
+	// DefaultNames are the sinks used when none are configured
+	DefaultNames = []string{"chat_data", "publish", "rabbitmq"}
+)
+
+// Build creates the sinks by name, limit returns how many messages a channel keeps in its chat data.
+func Build(gCtx ctx.Context, names []string, limit func(channel string) int64) ([]Sink, error) {
+	readerConf := gCtx.Config().Twitch.Reader
+
+	enabled := names
+	if len(enabled) == 0 {
+		enabled = DefaultNames
+	}
+
+	sinks := make([]Sink, 0, len(enabled))
+	seen := make(map[string]bool, len(enabled))
+
+	for _, name := range enabled {
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		switch name {
+		case "chat_data":
+			{
+				sinks = append(sinks, NewChatData(gCtx.Inst().Redis, limit))
+			}
+		case "publish":
+			{
+				sinks = append(sinks, NewPublish(gCtx.Inst().Redis))
+			}
+		case "rabbitmq":
+			{
+				if err := gCtx.Inst().RMQ.CreateExchange(gCtx, rabbitmq.ExchangeSettings{
+					Name: rabbitmq.ExchangeTwitchMessages,
+					Type: rabbitmq.ExchangeTypeTopic,
+				}); err != nil {
+					return nil, fmt.Errorf("rabbitmq: %w", err)
+				}
+
+				sinks = append(sinks, NewExchange(gCtx.Inst().RMQ))
+			}
+		case "archive":
+			{
+				ttl := time.Duration(readerConf.Archive.TTL) * time.Second
+
+				if err := mongo.EnsureArchiveIndexes(gCtx, gCtx.Inst().Mongo, ttl); err != nil {
+					return nil, fmt.Errorf("archive: %w", err)
+				}
+
+				sinks = append(sinks, NewArchive(gCtx.Inst().Mongo))
+			}
+		case "jsonl":
+			{
+				if readerConf.JSONL.Path == "" {
+					return nil, fmt.Errorf("jsonl: missing path")
+				}
+
+				s, err := NewJSONL(readerConf.JSONL.Path)
+				if err != nil {
+					return nil, fmt.Errorf("jsonl: %w", err)
+				}
+
+				sinks = append(sinks, s)
+			}
+		default:
+			return nil, fmt.Errorf("unknown sink %q", name)
+		}
+	}
+
+	return sinks, nil
+}
@@ -0,0 +1,57 @@
+package sink
+
+import (
+	"context"
+
+	"github.com/JoachimFlottorp/magnolia/internal/chatdata"
+	"github.com/JoachimFlottorp/magnolia/internal/redis"
+	"go.uber.org/zap"
+)
+
+// ChatData pushes messages to the redis buffer markov chains are generated from
+type ChatData struct {
+	inst  redis.Instance
+	limit func(channel string) int64
+}
+
+// NewChatData creates the sink, limit returns how many messages the channel keeps
+func NewChatData(inst redis.Instance, limit func(channel string) int64) *ChatData {
+	return &ChatData{inst, limit}
+}
+
+func (s *ChatData) Name() string {
+	return "chat_data"
+}
+
+func (s *ChatData) Write(ctx context.Context, msg Message) error {
+	if msg.Filtered {
+		return nil
+	}
+
+	channel := msg.Privmsg.Channel
+
+	return chatdata.Push(ctx, s.inst, channel, msg.Entry, s.limit(channel))
+}
+
+func (s *ChatData) Moderate(ctx context.Context, m Moderation) error {
+	if m.Purge {
+		if err := chatdata.Purge(ctx, s.inst, m.Channel); err != nil {
+			return err
+		}
+
+		zap.S().Infow("Chat was cleared, purged chat data", "channel", m.Channel)
+
+		return nil
+	}
+
+	removed, err := chatdata.Remove(ctx, s.inst, m.Channel, m.IDs...)
+	if err != nil {
+		return err
+	}
+
+	if removed > 0 {
+		zap.S().Debugw("Removed deleted messages from chat data", "channel", m.Channel, "removed", removed)
+	}
+
+	return nil
+}
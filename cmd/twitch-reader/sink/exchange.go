@@ -0,0 +1,146 @@
+package sink
+
+import (
+	"context"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/rabbitmq"
+	"github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// EXCHANGE_CONFIRM_WINDOW is how many messages can wait for their confirmation before writing waits for them
+	EXCHANGE_CONFIRM_WINDOW = 100
+	EXCHANGE_RETRY_MIN      = time.Second
+	EXCHANGE_RETRY_MAX      = 30 * time.Second
+)
+
+type pendingPublish struct {
+	key rabbitmq.QueueName
+	msg amqp091.Publishing
+	// conf is nil when the message could not be published at all
+	conf *amqp091.DeferredConfirmation
+}
+
+// Exchange publishes messages as IRCPrivmsg to the twitch-messages topic exchange,
+// routed by channel so consumers can bind to the channels they care about.
+//
+// Messages are published at least once, whatever the broker does not confirm is published again.
+// While the broker is down the sink falls behind, and the fanout drops messages for it like any other sink.
+type Exchange struct {
+	inst    rabbitmq.Instance
+	pending []pendingPublish
+}
+
+func NewExchange(inst rabbitmq.Instance) *Exchange {
+	return &Exchange{inst: inst}
+}
+
+func (s *Exchange) Name() string {
+	return "rabbitmq"
+}
+
+func (s *Exchange) Write(ctx context.Context, msg Message) error {
+	data, err := proto.Marshal(toPrivmsg(msg))
+	if err != nil {
+		return err
+	}
+
+	s.publish(ctx, pendingPublish{
+		key: rabbitmq.QueueName(rabbitmq.TwitchMessageKey(msg.Privmsg.Channel)),
+		msg: amqp091.Publishing{
+			Body:         data,
+			ContentType:  "application/protobuf; twitch.IRCPrivmsg",
+			DeliveryMode: amqp091.Persistent,
+			MessageId:    msg.Entry.ID,
+		},
+	})
+
+	if len(s.pending) < EXCHANGE_CONFIRM_WINDOW {
+		return nil
+	}
+
+	return s.settle(ctx)
+}
+
+// Flush waits until every published message has been confirmed
+func (s *Exchange) Flush(ctx context.Context) error {
+	return s.settle(ctx)
+}
+
+func (s *Exchange) publish(ctx context.Context, p pendingPublish) {
+	conf, err := s.inst.PublishDeferred(ctx, rabbitmq.PublishSettings{
+		Exchange:   rabbitmq.ExchangeTwitchMessages,
+		RoutingKey: p.key,
+		Msg:        p.msg,
+	})
+	if err != nil {
+		zap.S().Warnw("Failed to publish message, it is retried", "id", p.msg.MessageId, "error", err)
+	}
+
+	p.conf = conf
+	s.pending = append(s.pending, p)
+}
+
+// settle waits for the pending confirmations and publishes what was not confirmed again,
+// backing off between attempts until everything has been confirmed or the context is done.
+func (s *Exchange) settle(ctx context.Context) error {
+	wait := EXCHANGE_RETRY_MIN
+
+	for {
+		var failed []pendingPublish
+
+		for i, p := range s.pending {
+			ok, err := confirmed(ctx, p.conf)
+			if err != nil {
+				s.pending = append(failed, s.pending[i:]...)
+				return err
+			}
+
+			if !ok {
+				failed = append(failed, p)
+			}
+		}
+
+		s.pending = nil
+
+		if len(failed) == 0 {
+			return nil
+		}
+
+		zap.S().Warnw("Messages were not confirmed, publishing them again", "messages", len(failed), "in", wait)
+
+		select {
+		case <-ctx.Done():
+			s.pending = failed
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		if wait *= 2; wait > EXCHANGE_RETRY_MAX {
+			wait = EXCHANGE_RETRY_MAX
+		}
+
+		for _, p := range failed {
+			s.publish(ctx, p)
+		}
+	}
+}
+
+func confirmed(ctx context.Context, conf *amqp091.DeferredConfirmation) (bool, error) {
+	if conf == nil {
+		return false, nil
+	}
+
+	acked := make(chan bool, 1)
+	go func() { acked <- conf.Wait() }()
+
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case ok := <-acked:
+		return ok, nil
+	}
+}
@@ -0,0 +1,64 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+)
+
+// JSONL appends messages to a file, one JSON object per line.
+//
+// Like the chat data it does not say who sent a message.
+type JSONL struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+type jsonlLine struct {
+	Channel string `json:"channel"`
+	ID      string `json:"id"`
+	Text    string `json:"text"`
+	// Timestamp is in milliseconds
+	Timestamp int64 `json:"ts"`
+}
+
+// NewJSONL opens path for appending, creating it if needed
+func NewJSONL(path string) (*JSONL, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JSONL{file, bufio.NewWriter(file)}, nil
+}
+
+func (s *JSONL) Name() string {
+	return "jsonl"
+}
+
+func (s *JSONL) Write(ctx context.Context, msg Message) error {
+	data, err := json.Marshal(jsonlLine{
+		Channel:   msg.Privmsg.Channel,
+		ID:        msg.Entry.ID,
+		Text:      msg.Entry.Text,
+		Timestamp: msg.Entry.Timestamp,
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.w.Write(data); err != nil {
+		return err
+	}
+
+	return s.w.WriteByte('\n')
+}
+
+func (s *JSONL) Flush(ctx context.Context) error {
+	return s.w.Flush()
+}
+
+func (s *JSONL) Close() error {
+	return s.file.Close()
+}
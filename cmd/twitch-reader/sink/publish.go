@@ -0,0 +1,46 @@
+package sink
+
+import (
+	"context"
+
+	"github.com/JoachimFlottorp/magnolia/internal/redis"
+	pb "github.com/JoachimFlottorp/magnolia/protobuf"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	PUBLISH_CHANNEL = "twitch:messages"
+)
+
+// Publish publishes messages as IRCPrivmsg on the twitch:messages redis channel
+type Publish struct {
+	inst redis.Instance
+}
+
+func NewPublish(inst redis.Instance) *Publish {
+	return &Publish{inst}
+}
+
+func (s *Publish) Name() string {
+	return "publish"
+}
+
+func (s *Publish) Write(ctx context.Context, msg Message) error {
+	data, err := proto.Marshal(toPrivmsg(msg))
+	if err != nil {
+		return err
+	}
+
+	return s.inst.Publish(ctx, PUBLISH_CHANNEL, data)
+}
+
+func toPrivmsg(msg Message) *pb.IRCPrivmsg {
+	return &pb.IRCPrivmsg{
+		Message: msg.Privmsg.Message,
+		Channel: msg.Privmsg.Channel,
+		User: &pb.IRCUser{
+			Username: msg.Privmsg.User,
+			UserId:   msg.Privmsg.UserID(),
+		},
+	}
+}
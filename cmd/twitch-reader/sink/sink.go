@@ -0,0 +1,219 @@
+// Package sink hands the chat messages to everything consuming them.
+package sink
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/chatdata"
+	"github.com/JoachimFlottorp/magnolia/pkg/irc"
+	"go.uber.org/zap"
+)
+
+const (
+	DEFAULT_BUFFER = 1000
+	FLUSH_INTERVAL = 5 * time.Second
+	// SHUTDOWN_TIMEOUT is how long sinks get to write what is queued once the reader stops
+	SHUTDOWN_TIMEOUT = 5 * time.Second
+)
+
+// Message is a chat message read by the twitch-reader
+type Message struct {
+	Entry   chatdata.Entry
+	Privmsg *irc.PrivmsgMessage
+	// Filtered is set when the filters keep the message out of storage,
+	// sinks which store messages skip it while the others still get it.
+	//
+	// The filters are run once by the reader, as they remember what they have seen.
+	Filtered bool
+}
+
+// Moderation removes messages moderators deleted
+type Moderation struct {
+	Channel string
+	IDs     []string
+	// Purge removes everything stored for the channel, because its chat was cleared
+	Purge bool
+}
+
+// Sink consumes chat messages, each sink is written to by a single goroutine.
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, msg Message) error
+}
+
+// Moderator is implemented by sinks which have to remove what moderators deleted
+type Moderator interface {
+	Moderate(ctx context.Context, m Moderation) error
+}
+
+// Flusher is implemented by sinks which write in batches
+//
+// Flush is called every FLUSH_INTERVAL and before the sink is closed.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+type item struct {
+	msg        Message
+	moderation *Moderation
+}
+
+type worker struct {
+	sink    Sink
+	queue   chan item
+	dropped int64
+}
+
+// Fanout writes every message to each of its sinks.
+//
+// Every sink has its own buffer, a sink which can not keep up has messages dropped
+// instead of holding back the others or the reading of chat.
+type Fanout struct {
+	workers []*worker
+}
+
+// NewFanout creates a fanout where each sink can fall behind by buffer messages
+func NewFanout(sinks []Sink, buffer int) *Fanout {
+	if buffer <= 0 {
+		buffer = DEFAULT_BUFFER
+	}
+
+	f := &Fanout{
+		workers: make([]*worker, len(sinks)),
+	}
+
+	for i, s := range sinks {
+		f.workers[i] = &worker{
+			sink:  s,
+			queue: make(chan item, buffer),
+		}
+	}
+
+	return f
+}
+
+// Run writes to the sinks until the context is done, then writes what is queued and closes them.
+func (f *Fanout) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+
+	for _, w := range f.workers {
+		wg.Add(1)
+
+		go func(w *worker) {
+			defer wg.Done()
+
+			w.run(ctx)
+		}(w)
+	}
+
+	wg.Wait()
+}
+
+// Write queues the message for every sink, it never blocks.
+func (f *Fanout) Write(msg Message) {
+	for _, w := range f.workers {
+		select {
+		case w.queue <- item{msg: msg}:
+		default:
+			atomic.AddInt64(&w.dropped, 1)
+		}
+	}
+}
+
+// Moderate queues the moderation for every sink which implements Moderator.
+//
+// Unlike messages a moderation is never dropped, it waits for room in the buffer instead.
+func (f *Fanout) Moderate(ctx context.Context, m Moderation) {
+	for _, w := range f.workers {
+		if _, ok := w.sink.(Moderator); !ok {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case w.queue <- item{moderation: &m}:
+		}
+	}
+}
+
+// Dropped returns how many messages each sink dropped so far
+func (f *Fanout) Dropped() map[string]int64 {
+	dropped := make(map[string]int64, len(f.workers))
+	for _, w := range f.workers {
+		dropped[w.sink.Name()] = atomic.LoadInt64(&w.dropped)
+	}
+
+	return dropped
+}
+
+func (w *worker) run(ctx context.Context) {
+	ticker := time.NewTicker(FLUSH_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			{
+				// The context is gone, what is left gets a little time of its own
+				shutdown, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+				defer cancel()
+
+				w.drain(shutdown)
+				w.flush(shutdown)
+
+				if c, ok := w.sink.(io.Closer); ok {
+					if err := c.Close(); err != nil {
+						zap.S().Errorw("Failed to close sink", "sink", w.sink.Name(), "error", err)
+					}
+				}
+
+				return
+			}
+		case it := <-w.queue:
+			w.handle(ctx, it)
+		case <-ticker.C:
+			w.flush(ctx)
+		}
+	}
+}
+
+func (w *worker) drain(ctx context.Context) {
+	for {
+		select {
+		case it := <-w.queue:
+			w.handle(ctx, it)
+		default:
+			return
+		}
+	}
+}
+
+func (w *worker) handle(ctx context.Context, it item) {
+	if it.moderation != nil {
+		if err := w.sink.(Moderator).Moderate(ctx, *it.moderation); err != nil {
+			zap.S().Errorw("Failed to remove deleted messages", "sink", w.sink.Name(), "channel", it.moderation.Channel, "error", err)
+		}
+
+		return
+	}
+
+	if err := w.sink.Write(ctx, it.msg); err != nil {
+		zap.S().Errorw("Failed to write message", "sink", w.sink.Name(), "channel", it.msg.Privmsg.Channel, "error", err)
+	}
+}
+
+func (w *worker) flush(ctx context.Context) {
+	f, ok := w.sink.(Flusher)
+	if !ok {
+		return
+	}
+
+	if err := f.Flush(ctx); err != nil {
+		zap.S().Errorw("Failed to flush sink", "sink", w.sink.Name(), "error", err)
+	}
+}
@@ -0,0 +1,229 @@
+package sink
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/chatdata"
+	"github.com/JoachimFlottorp/magnolia/internal/mongo"
+	"github.com/JoachimFlottorp/magnolia/pkg/irc"
+)
+
+type recordingSink struct {
+	name string
+	// block holds back writes until it is closed
+	block chan struct{}
+
+	mtx     sync.Mutex
+	written []string
+	removed []string
+	flushed bool
+}
+
+func (s *recordingSink) Name() string {
+	return s.name
+}
+
+func (s *recordingSink) Write(ctx context.Context, msg Message) error {
+	if s.block != nil {
+		<-s.block
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.written = append(s.written, msg.Entry.ID)
+
+	return nil
+}
+
+func (s *recordingSink) Moderate(ctx context.Context, m Moderation) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.removed = append(s.removed, m.IDs...)
+
+	return nil
+}
+
+func (s *recordingSink) Flush(ctx context.Context) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.flushed = true
+
+	return nil
+}
+
+func (s *recordingSink) snapshot() ([]string, []string, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return append([]string{}, s.written...), append([]string{}, s.removed...), s.flushed
+}
+
+func message(t *testing.T, id string) Message {
+	t.Helper()
+
+	line := "@id=" + id + ";room-id=1;user-id=2 :forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :AlienPls"
+
+	msg, err := irc.ParseLine(line)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", line, err)
+	}
+
+	privmsg := msg.(*irc.PrivmsgMessage)
+
+	return Message{
+		Entry:   chatdata.NewEntry(id, privmsg.Message, time.Now()),
+		Privmsg: privmsg,
+	}
+}
+
+func TestFanout(t *testing.T) {
+	a := &recordingSink{name: "a"}
+	b := &recordingSink{name: "b"}
+
+	f := NewFanout([]Sink{a, b}, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+
+	f.Write(message(t, "1"))
+	f.Write(message(t, "2"))
+	f.Moderate(ctx, Moderation{Channel: "forsen", IDs: []string{"1"}})
+	f.Write(message(t, "3"))
+
+	cancel()
+	<-done
+
+	for _, s := range []*recordingSink{a, b} {
+		written, removed, flushed := s.snapshot()
+
+		if len(written) != 3 || written[0] != "1" || written[1] != "2" || written[2] != "3" {
+			t.Errorf("%s: got written %v, want [1 2 3]", s.name, written)
+		}
+
+		if len(removed) != 1 || removed[0] != "1" {
+			t.Errorf("%s: got removed %v, want [1]", s.name, removed)
+		}
+
+		if !flushed {
+			t.Errorf("%s: was not flushed on shutdown", s.name)
+		}
+	}
+}
+
+func TestFanoutDropsForSlowSink(t *testing.T) {
+	slow := &recordingSink{name: "slow", block: make(chan struct{})}
+	fast := &recordingSink{name: "fast"}
+
+	f := NewFanout([]Sink{slow, fast}, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+
+	// The slow sink holds on to the first message, two more fill its buffer and the rest are dropped
+	for _, id := range []string{"1", "2", "3", "4", "5", "6"} {
+		f.Write(message(t, id))
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	dropped := f.Dropped()
+	if dropped["slow"] != 3 {
+		t.Errorf("slow sink dropped %d messages, want 3", dropped["slow"])
+	}
+
+	if dropped["fast"] != 0 {
+		t.Errorf("fast sink dropped %d messages, want 0", dropped["fast"])
+	}
+
+	close(slow.block)
+	cancel()
+	<-done
+
+	if written, _, _ := fast.snapshot(); len(written) != 6 {
+		t.Errorf("fast sink got %d messages, want 6", len(written))
+	}
+
+	if written, _, _ := slow.snapshot(); len(written) != 3 {
+		t.Errorf("slow sink got %d messages, want 3", len(written))
+	}
+}
+
+func TestArchiveBatches(t *testing.T) {
+	s := NewArchive(nil)
+	ctx := context.Background()
+
+	sent := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+
+	kept := message(t, "a")
+	kept.Entry = chatdata.NewEntry("a", kept.Entry.Text, sent)
+
+	filtered := message(t, "b")
+	filtered.Filtered = true
+
+	// Below the batch size nothing reaches Mongo
+	for _, msg := range []Message{kept, filtered} {
+		if err := s.Write(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(s.batch) != 1 {
+		t.Fatalf("got %d batched messages, want only the one which was not filtered", len(s.batch))
+	}
+
+	archived := s.batch[0]
+	if archived.MsgID != "a" || archived.ChannelID != "1" || archived.Text != "AlienPls" || !archived.Timestamp.Equal(sent) {
+		t.Errorf("got %+v, want message a of room 1 sent an hour ago", archived)
+	}
+
+	// A whole chat being cleared keeps the archive, so Mongo is not touched either
+	if err := s.Moderate(ctx, Moderation{Channel: "forsen", Purge: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.batch) != 1 {
+		t.Errorf("got %d batched messages after clearing the chat, want it kept", len(s.batch))
+	}
+}
+
+func TestArchiveTrim(t *testing.T) {
+	s := NewArchive(nil)
+
+	for i := 0; i < ARCHIVE_MAX_BATCH; i++ {
+		s.batch = append(s.batch, mongo.ArchivedMessage{MsgID: strconv.Itoa(i)})
+	}
+
+	s.trim()
+
+	if len(s.batch) != ARCHIVE_MAX_BATCH-ARCHIVE_BATCH_SIZE {
+		t.Fatalf("got %d kept messages, want %d", len(s.batch), ARCHIVE_MAX_BATCH-ARCHIVE_BATCH_SIZE)
+	}
+
+	if first := s.batch[0].MsgID; first != strconv.Itoa(ARCHIVE_BATCH_SIZE) {
+		t.Errorf("got %s as the oldest kept message, want the oldest batch dropped", first)
+	}
+
+	// Below the limit a failed batch is kept as is
+	s.trim()
+
+	if len(s.batch) != ARCHIVE_MAX_BATCH-ARCHIVE_BATCH_SIZE {
+		t.Errorf("got %d kept messages, want none dropped below the limit", len(s.batch))
+	}
+}
@@ -0,0 +1,86 @@
+package recentmessages
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/JoachimFlottorp/magnolia/pkg/irc"
+)
+
+const (
+	// DEFAULT_URL is the base of the recent-messages API used unless one is configured
+	DEFAULT_URL = "https://recent-messages.zneix.eu/api/v2/"
+	// MAX_LIMIT is the most messages recent-messages keeps for a channel
+	MAX_LIMIT = 800
+)
+
+type historyResponse struct {
+	Messages  []string `json:"messages"`
+	Error     *string  `json:"error"`
+	ErrorCode *string  `json:"error_code"`
+}
+
+// History returns the chat messages recent-messages has of the channel, oldest first.
+//
+// baseURL is the base of the API like DEFAULT_URL, so a local stand-in can be used.
+// Messages which were deleted by moderators are left out.
+func History(ctx context.Context, client *http.Client, baseURL string, channel string, limit int) ([]*irc.PrivmsgMessage, error) {
+	if baseURL == "" {
+		baseURL = DEFAULT_URL
+	}
+
+	if limit <= 0 || limit > MAX_LIMIT {
+		limit = MAX_LIMIT
+	}
+
+	u := fmt.Sprintf("%s/recent-messages/%s?limit=%d", strings.TrimRight(baseURL, "/"), url.PathEscape(channel), limit)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", "Magnolia")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	var data historyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("recent-messages responded with %d: %w", resp.StatusCode, err)
+	}
+
+	if data.Error != nil {
+		return nil, fmt.Errorf("recent-messages: %s", *data.Error)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("recent-messages responded with %d", resp.StatusCode)
+	}
+
+	messages := make([]*irc.PrivmsgMessage, 0, len(data.Messages))
+
+	for _, line := range data.Messages {
+		msg, err := irc.ParseLine(line)
+		if err != nil {
+			continue
+		}
+
+		privmsg, ok := msg.(*irc.PrivmsgMessage)
+		if !ok || privmsg.Tags["rm-deleted"] == "1" {
+			continue
+		}
+
+		messages = append(messages, privmsg)
+	}
+
+	return messages, nil
+}
@@ -0,0 +1,59 @@
+package recentmessages
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testServer(t *testing.T, status int, body interface{}) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/recent-messages/forsen", r.URL.Path)
+		assert.Equal(t, "100", r.URL.Query().Get("limit"))
+
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestHistory(t *testing.T) {
+	srv := testServer(t, http.StatusOK, map[string]interface{}{
+		"messages": []string{
+			"@historical=1;id=1;rm-received-ts=1672671845000;tmi-sent-ts=1672671845000 :forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :AlienPls",
+			"@historical=1;rm-received-ts=1672671846000 :tmi.twitch.tv CLEARCHAT #forsen :someone",
+			"@historical=1;id=2;rm-deleted=1 :forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :deleted",
+			"@historical=1;id=3;tmi-sent-ts=1672671847000 :forsen!forsen@forsen.tmi.twitch.tv PRIVMSG #forsen :forsenE",
+		},
+		"error":      nil,
+		"error_code": nil,
+	})
+
+	messages, err := History(context.Background(), srv.Client(), srv.URL+"/api/v2/", "forsen", 100)
+
+	assert.Nil(t, err)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "AlienPls", messages[0].Message)
+	assert.Equal(t, "1", messages[0].ID())
+	assert.Equal(t, "forsenE", messages[1].Message)
+}
+
+func TestHistoryError(t *testing.T) {
+	srv := testServer(t, http.StatusNotFound, map[string]interface{}{
+		"messages":   []string{},
+		"error":      "The channel has been suspended",
+		"error_code": "channel_suspended",
+	})
+
+	messages, err := History(context.Background(), srv.Client(), srv.URL+"/api/v2", "forsen", 100)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, messages)
+}
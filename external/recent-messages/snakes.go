@@ -7,7 +7,7 @@ import (
 	"github.com/JoachimFlottorp/magnolia/external"
 )
 
-const snakesUrl = "https://recent-messages.zneix.eu/api/v2/recent-messages/%s?limit=1"
+const snakesUrl = DEFAULT_URL + "recent-messages/%s?limit=1"
 
 // const snakesUrl = "https://recent-messages.zneix.eu/"
 
@@ -3,6 +3,7 @@ package supibot
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"go.uber.org/zap"
@@ -54,7 +55,7 @@ func GetBotList(ctx context.Context, client *http.Client) (*OuterResponse[BotLis
 
 	if resp.StatusCode != http.StatusOK {
 		zap.S().Errorf("[Supibot] Error bot/list: %s", data)
-		return nil, err
+		return nil, fmt.Errorf("supibot responded with %d", resp.StatusCode)
 	}
 
 	return &data, nil
@@ -0,0 +1,186 @@
+// Package botlist keeps the names of chat bots whose messages should not be stored.
+package botlist
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/external/supibot"
+	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/internal/mongo"
+	"github.com/JoachimFlottorp/magnolia/internal/redis"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+const (
+	// REDIS_KEY caches the shared list, so only one reader has to build it
+	REDIS_KEY        = "twitch:bots"
+	REFRESH_INTERVAL = 10 * time.Minute
+)
+
+// List is a set of lowercase bot names which can be replaced while it is read.
+type List struct {
+	names atomic.Value
+}
+
+func New() *List {
+	l := &List{}
+	l.names.Store(map[string]bool{})
+
+	return l
+}
+
+func (l *List) Has(name string) bool {
+	return l.names.Load().(map[string]bool)[strings.ToLower(name)]
+}
+
+func (l *List) Len() int {
+	return len(l.names.Load().(map[string]bool))
+}
+
+// Set replaces the list
+func (l *List) Set(names []string) {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+
+		set[strings.ToLower(name)] = true
+	}
+
+	l.names.Store(set)
+}
+
+// Refresher keeps a List up to date with the Supibot bot registry and the bots ignored in Mongo.
+type Refresher struct {
+	ctx    ctx.Context
+	list   *List
+	static []string
+	client *http.Client
+	// supibot is the last registry fetched, used while Supibot can't be reached
+	supibot []string
+}
+
+// NewRefresher creates a refresher which always adds static to the list.
+func NewRefresher(gCtx ctx.Context, list *List, static []string, client *http.Client) *Refresher {
+	return &Refresher{
+		ctx:    gCtx,
+		list:   list,
+		static: static,
+		client: client,
+	}
+}
+
+// Run refreshes the list right away and then every REFRESH_INTERVAL until the context is done.
+func (r *Refresher) Run() {
+	for {
+		if err := r.Refresh(); err != nil {
+			zap.S().Errorw("Failed to refresh bot list", "error", err)
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(REFRESH_INTERVAL):
+		}
+	}
+}
+
+// Refresh loads the list from the redis cache, or builds and caches it if it expired.
+func (r *Refresher) Refresh() error {
+	names, err := r.cached()
+	if err != nil {
+		var complete bool
+
+		names, complete, err = r.build()
+		if err != nil {
+			return err
+		}
+
+		// Without Supibot's bots the list is not cached, so the next refresh tries again
+		if complete {
+			if err := r.cache(names); err != nil {
+				zap.S().Warnw("Failed to cache bot list", "error", err)
+			}
+		}
+	}
+
+	r.list.Set(append(names, r.static...))
+
+	zap.S().Debugw("Refreshed bot list", "count", r.list.Len())
+
+	return nil
+}
+
+func (r *Refresher) cached() ([]string, error) {
+	data, err := r.ctx.Inst().Redis.Get(r.ctx, REDIS_KEY)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if err := json.Unmarshal([]byte(data), &names); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+func (r *Refresher) cache(names []string) error {
+	data, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+
+	return r.ctx.Inst().Redis.SetEx(r.ctx, REDIS_KEY, string(data), REFRESH_INTERVAL)
+}
+
+// build combines the Supibot registry with the bots ignored in Mongo.
+//
+// When Supibot can't be reached the last registry it returned is used instead, it reports if the list is complete.
+func (r *Refresher) build() ([]string, bool, error) {
+	complete := true
+
+	botList, err := supibot.GetBotList(r.ctx, r.client)
+	if err != nil {
+		zap.S().Errorw("Failed to get Supibot bot list, using the last one", "error", err, "count", len(r.supibot))
+
+		complete = false
+	} else {
+		registry := make([]string, 0, len(botList.Data.Bots))
+		for _, bot := range botList.Data.Bots {
+			registry = append(registry, bot.Name)
+		}
+
+		r.supibot = registry
+	}
+
+	names := append([]string{}, r.supibot...)
+
+	cursor, err := r.ctx.Inst().Mongo.Collection(mongo.CollectionIgnoredBots).Find(r.ctx, bson.M{})
+	if err != nil {
+		return nil, false, err
+	}
+
+	ignored := []mongo.IgnoredBot{}
+	if err := cursor.All(r.ctx, &ignored); err != nil {
+		return nil, false, err
+	}
+
+	for _, bot := range ignored {
+		names = append(names, bot.Name)
+	}
+
+	return names, complete, nil
+}
+
+// Invalidate drops the cached list, so the change of an admin is picked up on the next refresh.
+func Invalidate(ctx context.Context, i redis.Instance) error {
+	return i.Del(ctx, REDIS_KEY)
+}
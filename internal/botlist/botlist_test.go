@@ -0,0 +1,29 @@
+package botlist
+
+import (
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	l := New()
+
+	if l.Has("supibot") {
+		t.Errorf("empty list has supibot")
+	}
+
+	l.Set([]string{"Supibot", "", "fossabot"})
+
+	if !l.Has("supibot") || !l.Has("SUPIBOT") || !l.Has("fossabot") {
+		t.Errorf("list is missing a bot")
+	}
+
+	if got := l.Len(); got != 2 {
+		t.Errorf("got %d bots, want 2", got)
+	}
+
+	l.Set([]string{"fossabot"})
+
+	if l.Has("supibot") {
+		t.Errorf("got supibot after it was removed")
+	}
+}
@@ -0,0 +1,227 @@
+// Package chatdata stores the chat messages markov chains are generated from.
+package chatdata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/markov"
+	"github.com/JoachimFlottorp/magnolia/internal/redis"
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// Entry is a single chat message in a channel's buffer.
+//
+// The author is deliberately not stored, see Tracker.
+type Entry struct {
+	ID        string `json:"id"`
+	Text      string `json:"text"`
+	Timestamp int64  `json:"ts"`
+}
+
+// Key returns the redis list holding the chat data of the channel
+func Key(channel string) string {
+	return fmt.Sprintf("twitch:%s:chat-data", channel)
+}
+
+func NewEntry(id, text string, ts time.Time) Entry {
+	return Entry{
+		ID:        id,
+		Text:      text,
+		Timestamp: ts.UnixMilli(),
+	}
+}
+
+func (e Entry) Encode() string {
+	data, _ := json.Marshal(e)
+
+	return string(data)
+}
+
+// Decode reads an entry, buffers written before entries existed only hold the text.
+func Decode(raw string) Entry {
+	if strings.HasPrefix(raw, "{") {
+		var e Entry
+		if err := json.Unmarshal([]byte(raw), &e); err == nil && e.Text != "" {
+			return e
+		}
+	}
+
+	return Entry{Text: raw}
+}
+
+// channelLocks keep the buffer and model of a channel from changing while the model is rebuilt from the buffer.
+//
+// Only the shard owning a channel writes its chat data, so locking within the process is enough.
+var channelLocks = struct {
+	mtx   sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: make(map[string]*sync.Mutex)}
+
+// lock locks the channel and returns the function unlocking it
+func lock(channel string) func() {
+	channelLocks.mtx.Lock()
+	l, ok := channelLocks.locks[channel]
+	if !ok {
+		l = &sync.Mutex{}
+		channelLocks.locks[channel] = l
+	}
+	channelLocks.mtx.Unlock()
+
+	l.Lock()
+
+	return l.Unlock
+}
+
+// Texts decodes the entries and returns only their text
+func Texts(raw []string) []string {
+	texts := make([]string, len(raw))
+	for i, r := range raw {
+		texts[i] = Decode(r).Text
+	}
+
+	return texts
+}
+
+// Push adds the entry to the channel's buffer, keeping at most max entries.
+//
+// The markov model of the channel follows the buffer, see the markov package.
+func Push(ctx context.Context, i redis.Instance, channel string, e Entry, max int64) error {
+	defer lock(channel)()
+
+	trimmed, err := i.LPushTrim(ctx, Key(channel), e.Encode(), max)
+	if err != nil {
+		return err
+	}
+
+	return markov.Update(ctx, i, channel, []string{e.Text}, Texts(trimmed))
+}
+
+// Trim keeps only the newest max entries of the channel's buffer
+func Trim(ctx context.Context, i redis.Instance, channel string, max int64) error {
+	defer lock(channel)()
+
+	trimmed, err := i.LTrim(ctx, Key(channel), max)
+	if err != nil {
+		return err
+	}
+
+	return markov.Remove(ctx, i, channel, Texts(trimmed)...)
+}
+
+// TrimOlderThan deletes the entries sent before cutoff and returns how many were deleted.
+//
+// Entries are pushed newest first, so only the end of the buffer has to be looked at.
+func TrimOlderThan(ctx context.Context, i redis.Instance, channel string, cutoff time.Time) (int64, error) {
+	defer lock(channel)()
+
+	popped, err := i.RPopOlderThan(ctx, Key(channel), "ts", cutoff.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(popped)), markov.Remove(ctx, i, channel, Texts(popped)...)
+}
+
+// RebuildModel counts the channel's buffer into a new markov model.
+//
+// The channel's chat data can not change until it is done, so no message is counted twice or missed.
+func RebuildModel(ctx context.Context, i redis.Instance, channel string) error {
+	defer lock(channel)()
+
+	stored, err := i.GetAllList(ctx, Key(channel))
+	if err != nil && err != goredis.Nil {
+		return err
+	}
+
+	return markov.Rebuild(ctx, i, channel, Texts(stored))
+}
+
+// Newest returns the latest entry of the channel's buffer, false if it is empty.
+func Newest(ctx context.Context, i redis.Instance, channel string) (Entry, bool, error) {
+	raw, err := i.LIndex(ctx, Key(channel), 0)
+	if err == goredis.Nil {
+		return Entry{}, false, nil
+	} else if err != nil {
+		return Entry{}, false, err
+	}
+
+	return Decode(raw), true, nil
+}
+
+// Channel returns the channel of a key made by Key, the redis prefix may be included.
+func Channel(key string) (string, bool) {
+	_, key, found := strings.Cut(key, "twitch:")
+	if !found || !strings.HasSuffix(key, ":chat-data") {
+		return "", false
+	}
+
+	channel := strings.TrimSuffix(key, ":chat-data")
+
+	return channel, channel != ""
+}
+
+// Remove deletes the entries with the given ids from the channel's buffer and returns how many were removed.
+func Remove(ctx context.Context, i redis.Instance, channel string, ids ...string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	defer lock(channel)()
+
+	key := Key(channel)
+
+	stored, err := i.GetAllList(ctx, key)
+	if err == goredis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	remove := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+
+	var removed []string
+	for _, raw := range stored {
+		e := Decode(raw)
+		if e.ID == "" || !remove[e.ID] {
+			continue
+		}
+
+		n, err := i.LRem(ctx, key, 1, raw)
+		if err != nil {
+			// What was removed so far is out of the list, so it has to leave the model too
+			if mErr := markov.Remove(ctx, i, channel, removed...); mErr != nil {
+				return len(removed), fmt.Errorf("%w, and updating the markov model failed: %v", err, mErr)
+			}
+
+			return len(removed), err
+		}
+
+		// Someone else got to it first, like the trimming, and already took it out of the model
+		if n == 0 {
+			continue
+		}
+
+		removed = append(removed, e.Text)
+	}
+
+	return len(removed), markov.Remove(ctx, i, channel, removed...)
+}
+
+// Purge deletes the channel's whole buffer, leaving an empty markov model
+func Purge(ctx context.Context, i redis.Instance, channel string) error {
+	defer lock(channel)()
+
+	if err := i.Del(ctx, Key(channel)); err != nil {
+		return err
+	}
+
+	return markov.Rebuild(ctx, i, channel, nil)
+}
@@ -0,0 +1,93 @@
+package chatdata
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	entry := NewEntry("b34ccfc7-4977-403a-8a94-33c6bac34fb8", "AlienPls", time.UnixMilli(1665000000000))
+
+	testCases := []struct {
+		Raw  string
+		Want Entry
+	}{
+		{entry.Encode(), entry},
+		{"AlienPls", Entry{Text: "AlienPls"}},
+		{"{ forsen }", Entry{Text: "{ forsen }"}},
+		{`{"id":"1"}`, Entry{Text: `{"id":"1"}`}},
+	}
+
+	for _, testCase := range testCases {
+		if got := Decode(testCase.Raw); got != testCase.Want {
+			t.Errorf("%s: got %+v, want %+v", testCase.Raw, got, testCase.Want)
+		}
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(func(channel string) int64 {
+		if channel == "pajlada" {
+			return 5
+		}
+
+		return 3
+	})
+
+	tr.Track("forsen", "1", "a")
+	tr.Track("forsen", "2", "b")
+	tr.Track("forsen", "1", "c")
+	tr.Track("pajlada", "1", "d")
+
+	if got := tr.Forget("forsen", "1"); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Errorf("got %v, want [a c]", got)
+	}
+
+	if got := tr.Forget("forsen", "1"); len(got) != 0 {
+		t.Errorf("got %v after forgetting, want nothing", got)
+	}
+
+	// Pushes out b, the oldest message still tracked
+	tr.Track("forsen", "3", "e")
+	tr.Track("forsen", "3", "f")
+
+	if got := tr.Forget("forsen", "2"); len(got) != 0 {
+		t.Errorf("got %v, want the evicted message to be forgotten", got)
+	}
+
+	// pajlada keeps more messages than forsen, so more are tracked
+	for _, id := range []string{"g", "h", "i", "j"} {
+		tr.Track("pajlada", "1", id)
+	}
+
+	if got := tr.Forget("pajlada", "1"); !reflect.DeepEqual(got, []string{"d", "g", "h", "i", "j"}) {
+		t.Errorf("got %v, want [d g h i j]", got)
+	}
+
+	tr.Clear("forsen")
+
+	if got := tr.Forget("forsen", "3"); len(got) != 0 {
+		t.Errorf("got %v after clearing, want nothing", got)
+	}
+}
+
+func TestChannel(t *testing.T) {
+	testCases := []struct {
+		Key  string
+		Want string
+		OK   bool
+	}{
+		{Key("forsen"), "forsen", true},
+		{"magnolia:" + Key("forsen"), "forsen", true},
+		{"magnolia:twitch:forsen:emotes", "", false},
+		{"magnolia:twitch::chat-data", "", false},
+	}
+
+	for _, testCase := range testCases {
+		got, ok := Channel(testCase.Key)
+		if got != testCase.Want || ok != testCase.OK {
+			t.Errorf("%s: got %q %v, want %q %v", testCase.Key, got, ok, testCase.Want, testCase.OK)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package chatdata
+
+import (
+	"sync"
+)
+
+// Tracker remembers which messages in a channel's buffer were written by which user,
+// so their messages can be removed when they are timed out or banned.
+//
+// It only lives in memory, user ids are never written next to the chat data.
+type Tracker struct {
+	mtx      sync.Mutex
+	limit    func(channel string) int64
+	channels map[string]*channelTracker
+}
+
+type trackedMessage struct {
+	userID string
+	id     string
+}
+
+type channelTracker struct {
+	// order is oldest first
+	order  []trackedMessage
+	byUser map[string][]string
+}
+
+// NewTracker creates a tracker remembering the latest messages of each channel,
+// limit returns how many and should match the size of the channel's buffer.
+func NewTracker(limit func(channel string) int64) *Tracker {
+	return &Tracker{
+		limit:    limit,
+		channels: make(map[string]*channelTracker),
+	}
+}
+
+func (t *Tracker) Track(channel, userID, id string) {
+	if userID == "" || id == "" {
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	ch, ok := t.channels[channel]
+	if !ok {
+		ch = &channelTracker{
+			order:  make([]trackedMessage, 0),
+			byUser: make(map[string][]string),
+		}
+		t.channels[channel] = ch
+	}
+
+	ch.order = append(ch.order, trackedMessage{userID, id})
+	ch.byUser[userID] = append(ch.byUser[userID], id)
+
+	limit := t.limit(channel)
+
+	for int64(len(ch.order)) > limit {
+		oldest := ch.order[0]
+		ch.order = ch.order[1:]
+
+		ids := ch.byUser[oldest.userID]
+		if len(ids) > 0 && ids[0] == oldest.id {
+			ids = ids[1:]
+		}
+
+		if len(ids) == 0 {
+			delete(ch.byUser, oldest.userID)
+		} else {
+			ch.byUser[oldest.userID] = ids
+		}
+	}
+}
+
+// Forget returns the ids of every tracked message the user sent in the channel and stops tracking them.
+func (t *Tracker) Forget(channel, userID string) []string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	ch, ok := t.channels[channel]
+	if !ok {
+		return nil
+	}
+
+	ids := ch.byUser[userID]
+	delete(ch.byUser, userID)
+
+	return ids
+}
+
+// Clear stops tracking the channel
+func (t *Tracker) Clear(channel string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	delete(t.channels, channel)
+}
@@ -34,21 +34,112 @@ type Config struct {
 	Markov struct {
 		HealthAddress string `toml:"health_address"`
 		HealthBind    int    `toml:"health_bind"`
+		// Generator is remote for the markov-generator or native to generate in the api,
+		// remote falls back to native while the markov-generator is not healthy
+		Generator string `toml:"generator"`
 	} `toml:"markov"`
 	Http struct {
 		Port      int    `toml:"port"`
 		PublicURL string `toml:"public_url"`
 	} `toml:"http"`
 	Twitch struct {
-		Bot struct {
+		// Address of the Twitch IRC server, wss:// for websockets or ircs:// for TLS
+		Address string `toml:"address"`
+		Bot     struct {
 			Username string   `toml:"username"`
 			Password string   `toml:"password"`
 			Admins   []string `toml:"admins"`
 			Prefix   string   `toml:"prefix"`
+			// Channels the bot reads commands in, every channel the reader is in when empty
+			Channels []string `toml:"channels"`
 		} `toml:"bot"`
+		Reader struct {
+			Username string `toml:"username"`
+			Password string `toml:"password"`
+			// One of anonymous, normal, known or verified
+			Tier string `toml:"tier"`
+			// JoinLimit overrides the JOIN budget of the tier, for an account allowed more than Twitch documents
+			JoinLimit struct {
+				Count int `toml:"count"`
+				// Period is in seconds
+				Period int `toml:"period"`
+			} `toml:"join_limit"`
+			// ChannelsPerConnection is how many channels are read on a single connection, 100 when 0
+			ChannelsPerConnection int `toml:"channels_per_connection"`
+			// ShardID has to be unique for every running reader and stay the same across restarts, the hostname when empty
+			ShardID string `toml:"shard_id"`
+			// PurgeOnClear deletes a channel's chat data when its whole chat is cleared
+			PurgeOnClear bool `toml:"purge_on_clear"`
+			// Retention is used for channels without their own retention in Mongo
+			Retention struct {
+				MaxMessages int64 `toml:"max_messages"`
+				// MaxAge is in seconds, 0 keeps messages until they are pushed out by newer ones
+				MaxAge int64 `toml:"max_age"`
+				// InactiveAfter is in seconds, channels without a message for this long have their chat data deleted
+				InactiveAfter int64 `toml:"inactive_after"`
+			} `toml:"retention"`
+			// Sinks are what stored messages are written to
+			Sinks struct {
+				// Enabled lists sinks by name, chat_data, publish and rabbitmq when empty
+				Enabled []string `toml:"enabled"`
+				// Buffer is how many messages a sink can fall behind before messages are dropped for it
+				Buffer int `toml:"buffer"`
+			} `toml:"sinks"`
+			// Backfill seeds the chat data of new channels from a recent-messages service
+			Backfill struct {
+				Enabled bool `toml:"enabled"`
+				// URL is the base of the recent-messages API, https://recent-messages.zneix.eu/api/v2/ when empty
+				URL string `toml:"url"`
+				// Limit is how many messages are requested, at most 800
+				Limit int `toml:"limit"`
+			} `toml:"backfill"`
+			// Archive keeps every stored message in Mongo, with the archive sink
+			Archive struct {
+				// TTL is in seconds, 0 keeps messages forever
+				TTL int64 `toml:"ttl"`
+			} `toml:"archive"`
+			// JSONL appends every stored message to a file, with the jsonl sink
+			JSONL struct {
+				Path string `toml:"path"`
+			} `toml:"jsonl"`
+			// Filter applies to every channel
+			Filter FilterConfig `toml:"filter"`
+			// ChannelFilters are merged on top of Filter for a single channel
+			ChannelFilters map[string]FilterConfig `toml:"channel_filters"`
+		} `toml:"reader"`
 	} `toml:"twitch"`
 }
 
+// FilterConfig decides which chat messages the twitch-reader does not store.
+//
+// It is also stored on channels in Mongo, so it carries bson tags as well.
+type FilterConfig struct {
+	// Order lists filters by name in the order they run, the ones left out run afterwards
+	Order []string `toml:"order" bson:"order,omitempty" json:"order,omitempty"`
+	// Bots are usernames which are always dropped
+	Bots []string `toml:"bots" bson:"bots,omitempty" json:"bots,omitempty"`
+	// BotPattern matches usernames of bots, a built in pattern is used when empty
+	BotPattern string `toml:"bot_pattern" bson:"bot_pattern,omitempty" json:"bot_pattern,omitempty"`
+	// VerifiedBots drops users with the verified bot badge
+	VerifiedBots *bool `toml:"verified_bots" bson:"verified_bots,omitempty" json:"verified_bots,omitempty"`
+	// CommandPrefixes drops messages starting with any of them, like ! or $
+	CommandPrefixes []string `toml:"command_prefixes" bson:"command_prefixes,omitempty" json:"command_prefixes,omitempty"`
+	// URLs drops messages containing links
+	URLs *bool `toml:"urls" bson:"urls,omitempty" json:"urls,omitempty"`
+	// MinLength and MaxLength are in characters, 0 disables them.
+	// The thresholds are pointers so a channel can set 0 to disable a global one
+	MinLength *int `toml:"min_length" bson:"min_length,omitempty" json:"min_length,omitempty"`
+	MaxLength *int `toml:"max_length" bson:"max_length,omitempty" json:"max_length,omitempty"`
+	// EmoteOnly drops messages made up of only Twitch emotes
+	EmoteOnly *bool `toml:"emote_only" bson:"emote_only,omitempty" json:"emote_only,omitempty"`
+	// RepeatWindow is in seconds, a user sending the same message again within it is dropped
+	RepeatWindow *int `toml:"repeat_window" bson:"repeat_window,omitempty" json:"repeat_window,omitempty"`
+	// MaxNonLatin is the highest share of letters outside the latin script, between 0 and 1, 0 disables it
+	MaxNonLatin *float64 `toml:"max_non_latin" bson:"max_non_latin,omitempty" json:"max_non_latin,omitempty"`
+	// BannedWords drops messages containing any of them as a whole word, case insensitive
+	BannedWords []string `toml:"banned_words" bson:"banned_words,omitempty" json:"banned_words,omitempty"`
+}
+
 func ReplaceZapGlobal(isDebug bool) error {
 	config := &zap.Config{
 		Encoding:         "console",
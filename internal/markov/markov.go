@@ -0,0 +1,540 @@
+// Package markov keeps a word level markov chain of every channel in redis.
+//
+// The chain is updated as chat data is pushed and trimmed, rather than built from the
+// whole buffer for every sentence. For each state, the words which followed it are
+// counted in a hash of its own, so a sentence only takes one lookup per word and
+// counting a message only touches the counts of its words.
+//
+// A second chain counts the words in front of each state, which lets a seed be
+// placed anywhere in a sentence by walking backwards from it.
+package markov
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/redis"
+	goredis "github.com/go-redis/redis/v8"
+)
+
+const (
+	// MAX_STATE_SIZE is the longest state counted, every size up to it is kept
+	MAX_STATE_SIZE     = 2
+	DEFAULT_STATE_SIZE = 1
+	DEFAULT_MAX_WORDS  = 50
+	DEFAULT_MAX_TRIES  = 20
+
+	// VERSION is bumped whenever the way messages are counted changes, so the models are rebuilt
+	VERSION = "2"
+
+	// START and END pad the messages, they can not be part of a word as chat messages are printable
+	START = "\x02"
+	END   = "\x03"
+
+	// REBUILD_BATCH_SIZE is how many messages are counted by a single script while rebuilding
+	REBUILD_BATCH_SIZE = 100
+)
+
+var (
+	ErrNoModel          = errors.New("no model")
+	ErrSeedNotFound     = errors.New("seed has never been said")
+	ErrUnableToGenerate = errors.New("unable to generate a sentence")
+)
+
+// Store is where the model is kept, a redis.Instance satisfies it
+type Store interface {
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	AdjustCounts(ctx context.Context, deltas []redis.CountDelta) error
+}
+
+type direction string
+
+const (
+	forward  direction = "forward"
+	backward direction = "backward"
+)
+
+// Key returns the hash counting the words after the state, which is size words joined by spaces
+func Key(channel string, size int, state string) string {
+	return key(channel, forward, size, state)
+}
+
+func key(channel string, dir direction, size int, state string) string {
+	return fmt.Sprintf("twitch:%s:markov:%s:%d:%s", channel, dir, size, state)
+}
+
+func versionKey(channel string) string {
+	return fmt.Sprintf("twitch:%s:markov:version", channel)
+}
+
+// Words splits a message into the words the model is made of
+func Words(text string) []string {
+	words := strings.Fields(text)
+
+	n := 0
+	for _, w := range words {
+		if strings.ContainsAny(w, START+END) {
+			continue
+		}
+
+		words[n] = w
+		n++
+	}
+
+	return words[:n]
+}
+
+// transitions calls fn with every state of the given size in the sequence and the word after it,
+// the sequence is padded with size pad words in front and end at the end.
+func transitions(words []string, size int, pad, end string, fn func(state, next string)) {
+	seq := make([]string, 0, size+len(words)+1)
+	for i := 0; i < size; i++ {
+		seq = append(seq, pad)
+	}
+
+	seq = append(seq, words...)
+	seq = append(seq, end)
+
+	for i := size; i < len(seq); i++ {
+		fn(strings.Join(seq[i-size:i], " "), seq[i])
+	}
+}
+
+func reverse(words []string) []string {
+	r := make([]string, len(words))
+	for i, w := range words {
+		r[len(words)-1-i] = w
+	}
+
+	return r
+}
+
+// deltas returns the count changes of adding or removing the messages
+func deltas(channel string, delta int64, texts []string) []redis.CountDelta {
+	var d []redis.CountDelta
+
+	for _, text := range texts {
+		words := Words(text)
+		if len(words) == 0 {
+			continue
+		}
+
+		backwards := reverse(words)
+
+		for size := 1; size <= MAX_STATE_SIZE; size++ {
+			transitions(words, size, START, END, func(state, next string) {
+				d = append(d, redis.CountDelta{Key: key(channel, forward, size, state), Field: next, Delta: delta})
+			})
+
+			transitions(backwards, size, END, START, func(state, next string) {
+				d = append(d, redis.CountDelta{Key: key(channel, backward, size, state), Field: next, Delta: delta})
+			})
+		}
+	}
+
+	return d
+}
+
+// Update counts the added messages and uncounts the removed ones in a single script
+func Update(ctx context.Context, s Store, channel string, added, removed []string) error {
+	d := append(deltas(channel, 1, added), deltas(channel, -1, removed)...)
+
+	return s.AdjustCounts(ctx, d)
+}
+
+// Add counts the messages into the channel's model
+func Add(ctx context.Context, s Store, channel string, texts ...string) error {
+	return Update(ctx, s, channel, texts, nil)
+}
+
+// Remove uncounts messages which have been counted by Add
+func Remove(ctx context.Context, s Store, channel string, texts ...string) error {
+	return Update(ctx, s, channel, nil, texts)
+}
+
+// Purge deletes the channel's model, including what earlier VERSIONs stored
+func Purge(ctx context.Context, i redis.Instance, channel string) error {
+	if err := i.Del(ctx, versionKey(channel)); err != nil {
+		return err
+	}
+
+	return i.Scan(ctx, fmt.Sprintf("twitch:%s:markov:*", channel), func(key string) error {
+		return i.Del(ctx, key)
+	})
+}
+
+// Rebuild replaces the channel's model with one of the messages,
+// it is marked as built once every message has been counted.
+//
+// The model must not be updated until it is done, see chatdata.RebuildModel.
+func Rebuild(ctx context.Context, i redis.Instance, channel string, texts []string) error {
+	if err := Purge(ctx, i, channel); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(texts); start += REBUILD_BATCH_SIZE {
+		end := start + REBUILD_BATCH_SIZE
+		if end > len(texts) {
+			end = len(texts)
+		}
+
+		if err := Add(ctx, i, channel, texts[start:end]...); err != nil {
+			return err
+		}
+	}
+
+	return i.Set(ctx, versionKey(channel), VERSION)
+}
+
+// Built tells whether the channel's model has been rebuilt from its chat data by this VERSION
+func Built(ctx context.Context, i redis.Instance, channel string) (bool, error) {
+	v, err := i.Get(ctx, versionKey(channel))
+	if err == goredis.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return v == VERSION, nil
+}
+
+// SeedMode is where the seed goes in a sentence
+type SeedMode string
+
+const (
+	SEED_CONTAINS SeedMode = "contains"
+	SEED_START    SeedMode = "start"
+)
+
+type Options struct {
+	// StateSize is how many words the next word is picked by, up to MAX_STATE_SIZE
+	StateSize int
+	// MinWords is the least amount of words a sentence can have
+	MinWords int
+	// MinScore is the least score a sentence can have, see Sentence
+	MinScore int64
+	MaxWords int
+	// MaxTries is how many sentences are tried before giving up
+	MaxTries int
+	// Seed is a word the sentence has to contain
+	Seed string
+	// SeedMode is SEED_CONTAINS when empty
+	SeedMode SeedMode
+	// Rand picks the words, one seeded by the time is used if nil
+	Rand *rand.Rand
+}
+
+func (o Options) withDefaults() Options {
+	if o.StateSize <= 0 {
+		o.StateSize = DEFAULT_STATE_SIZE
+	} else if o.StateSize > MAX_STATE_SIZE {
+		o.StateSize = MAX_STATE_SIZE
+	}
+
+	if o.MaxWords <= 0 {
+		o.MaxWords = DEFAULT_MAX_WORDS
+	}
+
+	if o.MaxTries <= 0 {
+		o.MaxTries = DEFAULT_MAX_TRIES
+	}
+
+	if o.Rand == nil {
+		o.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	return o
+}
+
+// Sentence is a generated sentence
+type Sentence struct {
+	Text string
+	// Score is how many other words could have been picked along the way, a low score means
+	// the sentence is close to a message which was said. Every word adds the different words
+	// after its state minus one, like markov-strings does, so the same MinScore works for both
+	Score int64
+	// Sources is how many of the words picked could have been picked from each channel
+	Sources map[string]int
+}
+
+// Source is a channel's model a sentence is generated from
+type Source struct {
+	Channel string
+	Store   Store
+	// Weight is how much the channel is used compared to the other sources,
+	// regardless of how many messages each has
+	Weight float64
+}
+
+// Generate walks the channel's model into a sentence
+func Generate(ctx context.Context, s Store, channel string, opts Options) (Sentence, error) {
+	return Blend(ctx, []Source{{Channel: channel, Store: s, Weight: 1}}, opts)
+}
+
+// Blend walks the models of several channels at once into a sentence.
+//
+// Every word is picked from the words after the state in all of the models, with the counts
+// of each divided by how many messages the channel has and multiplied by its weight.
+// Sources without a model are left out.
+func Blend(ctx context.Context, sources []Source, opts Options) (Sentence, error) {
+	opts = opts.withDefaults()
+
+	g := &generator{
+		ctx:      ctx,
+		opts:     opts,
+		lookedUp: make(map[stateKey]*transition),
+	}
+
+	for _, src := range sources {
+		if src.Weight <= 0 {
+			continue
+		}
+
+		counts, err := counts(ctx, src, forward, 1, START)
+		if err == goredis.Nil {
+			continue
+		} else if err != nil {
+			return Sentence{}, err
+		}
+
+		// Every message starts once, so the words after START add up to the messages
+		var messages int64
+		for _, c := range counts {
+			messages += c
+		}
+
+		g.sources = append(g.sources, weightedSource{
+			Source: src,
+			scale:  src.Weight / float64(messages),
+		})
+	}
+
+	if len(g.sources) == 0 {
+		return Sentence{}, ErrNoModel
+	}
+
+	if opts.Seed != "" {
+		if t, err := g.lookup(forward, 1, opts.Seed); err != nil {
+			return Sentence{}, err
+		} else if t == nil {
+			return Sentence{}, ErrSeedNotFound
+		}
+	}
+
+	for try := 0; try < opts.MaxTries; try++ {
+		if err := ctx.Err(); err != nil {
+			return Sentence{}, err
+		}
+
+		sentence, words, err := g.sentence()
+		if err != nil {
+			return Sentence{}, err
+		}
+
+		if words >= opts.MinWords && sentence.Score >= opts.MinScore {
+			return sentence, nil
+		}
+	}
+
+	return Sentence{}, ErrUnableToGenerate
+}
+
+type weightedSource struct {
+	Source
+	scale float64
+}
+
+// transition is the words which can follow a state in any of the sources
+type transition struct {
+	weights map[string]float64
+	// from is the channels each word can follow the state in
+	from map[string][]string
+}
+
+type generator struct {
+	ctx     context.Context
+	sources []weightedSource
+	opts    Options
+	// lookedUp is every state looked up so far, the tries walk the same states over and over
+	lookedUp map[stateKey]*transition
+}
+
+type stateKey struct {
+	dir   direction
+	size  int
+	state string
+}
+
+func counts(ctx context.Context, src Source, dir direction, size int, state string) (map[string]int64, error) {
+	fields, err := src.Store.HGetAll(ctx, key(src.Channel, dir, size, state))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		return nil, goredis.Nil
+	}
+
+	counts := make(map[string]int64, len(fields))
+	for w, raw := range fields {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("count of %q after %q: %w", w, state, err)
+		}
+
+		counts[w] = n
+	}
+
+	return counts, nil
+}
+
+// lookup returns the words after the state in every source, nil if none of them have it.
+//
+// Each state is only fetched and decoded once per generator, including the ones no source has.
+func (g *generator) lookup(dir direction, size int, state string) (*transition, error) {
+	k := stateKey{dir: dir, size: size, state: state}
+	if t, ok := g.lookedUp[k]; ok {
+		return t, nil
+	}
+
+	var t *transition
+
+	for _, src := range g.sources {
+		c, err := counts(g.ctx, src.Source, dir, size, state)
+		if err == goredis.Nil {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if t == nil {
+			t = &transition{
+				weights: make(map[string]float64, len(c)),
+				from:    make(map[string][]string, len(c)),
+			}
+		}
+
+		for w, n := range c {
+			t.weights[w] += float64(n) * src.scale
+			t.from[w] = append(t.from[w], src.Channel)
+		}
+	}
+
+	g.lookedUp[k] = t
+
+	return t, nil
+}
+
+// pick picks a word by its weight, the words are sorted so a seeded Rand always picks the same
+func (g *generator) pick(t *transition) string {
+	words := make([]string, 0, len(t.weights))
+
+	var total float64
+	for w, weight := range t.weights {
+		words = append(words, w)
+		total += weight
+	}
+
+	sort.Strings(words)
+
+	n := g.opts.Rand.Float64() * total
+	for _, w := range words {
+		if n -= t.weights[w]; n < 0 {
+			return w
+		}
+	}
+
+	return words[len(words)-1]
+}
+
+// walk appends words to tokens until stop is picked or the sentence is long enough,
+// counting which channels each word could have been picked from in sources.
+//
+// A state shorter than the state size is used when there are not enough tokens yet, such as
+// right after a seed, or when the state has not been counted.
+func (g *generator) walk(dir direction, tokens []string, stop string, words *int, sources map[string]int) ([]string, int64, error) {
+	var score int64
+
+	for *words < g.opts.MaxWords {
+		var t *transition
+
+		size := g.opts.StateSize
+		if size > len(tokens) {
+			size = len(tokens)
+		}
+
+		for ; size > 0 && t == nil; size-- {
+			var err error
+			if t, err = g.lookup(dir, size, strings.Join(tokens[len(tokens)-size:], " ")); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		if t == nil {
+			break
+		}
+
+		next := g.pick(t)
+		score += int64(len(t.weights)) - 1
+
+		tokens = append(tokens, next)
+		if next == stop {
+			break
+		}
+
+		for _, channel := range t.from[next] {
+			sources[channel]++
+		}
+
+		*words++
+	}
+
+	return tokens, score, nil
+}
+
+func (g *generator) sentence() (Sentence, int, error) {
+	var tokens []string
+	words := 0
+	sources := make(map[string]int)
+
+	if g.opts.Seed == "" {
+		for i := 0; i < g.opts.StateSize; i++ {
+			tokens = append(tokens, START)
+		}
+	} else {
+		tokens = append(tokens, g.opts.Seed)
+		words++
+	}
+
+	tokens, score, err := g.walk(forward, tokens, END, &words, sources)
+	if err != nil {
+		return Sentence{}, 0, err
+	}
+
+	if g.opts.Seed != "" && g.opts.SeedMode != SEED_START {
+		var backScore int64
+
+		tokens, backScore, err = g.walk(backward, reverse(tokens), START, &words, sources)
+		if err != nil {
+			return Sentence{}, 0, err
+		}
+
+		tokens = reverse(tokens)
+		score += backScore
+	}
+
+	text := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		if t != START && t != END {
+			text = append(text, t)
+		}
+	}
+
+	return Sentence{Text: strings.Join(text, " "), Score: score, Sources: sources}, len(text), nil
+}
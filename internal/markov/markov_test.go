@@ -0,0 +1,255 @@
+package markov
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	if err := Add(ctx, s, "forsen", "forsen LULW", "forsen Pepega", "forsen LULW"); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := s.HGetAll(ctx, Key("forsen", 1, "forsen"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(counts) != 2 || counts["LULW"] != "2" || counts["Pepega"] != "1" {
+		t.Errorf("got %v, want LULW twice and Pepega once", counts)
+	}
+
+	if err := Remove(ctx, s, "forsen", "forsen LULW", "forsen Pepega"); err != nil {
+		t.Fatal(err)
+	}
+
+	if counts, _ := s.HGetAll(ctx, Key("forsen", 1, "forsen")); len(counts) != 1 || counts["LULW"] != "1" {
+		t.Errorf("got %v after removing, want LULW once", counts)
+	}
+
+	if err := Remove(ctx, s, "forsen", "forsen LULW"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := s.Len(); n != 0 {
+		t.Errorf("got %d states after removing every message, want none", n)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	if _, err := Generate(ctx, s, "forsen", Options{}); err != ErrNoModel {
+		t.Fatalf("got %v without a model, want ErrNoModel", err)
+	}
+
+	messages := []string{
+		"the quick brown fox jumps over the lazy dog",
+		"the lazy cat sleeps all day",
+		"a quick nap over the weekend",
+	}
+
+	if err := Add(ctx, s, "forsen", messages...); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every pair of words in a sentence must have been said one after another
+	said := map[string]bool{}
+	for _, m := range messages {
+		w := Words(m)
+		for i := 1; i < len(w); i++ {
+			said[w[i-1]+" "+w[i]] = true
+		}
+	}
+
+	r := rand.New(rand.NewSource(1))
+
+	for size := 1; size <= MAX_STATE_SIZE; size++ {
+		for _, seed := range []string{"", "lazy", "weekend"} {
+			sentence, err := Generate(ctx, s, "forsen", Options{StateSize: size, Seed: seed, Rand: r})
+			if err != nil {
+				t.Fatalf("size %d, seed %q: %v", size, seed, err)
+			}
+
+			w := Words(sentence.Text)
+			if len(w) == 0 {
+				t.Fatalf("size %d, seed %q: empty sentence", size, seed)
+			}
+
+			if seed != "" && !strings.Contains(" "+sentence.Text+" ", " "+seed+" ") {
+				t.Errorf("size %d: %q does not contain the seed %q", size, sentence.Text, seed)
+			}
+
+			for i := 1; i < len(w); i++ {
+				if pair := w[i-1] + " " + w[i]; !said[pair] {
+					t.Errorf("size %d, seed %q: %q was never said in %q", size, seed, pair, sentence.Text)
+				}
+			}
+		}
+	}
+
+	if _, err := Generate(ctx, s, "forsen", Options{Seed: "xqc", Rand: r}); err != ErrSeedNotFound {
+		t.Errorf("got %v for a seed never said, want ErrSeedNotFound", err)
+	}
+
+	if _, err := Generate(ctx, s, "forsen", Options{MinWords: 100, Rand: r}); err != ErrUnableToGenerate {
+		t.Errorf("got %v for too many words, want ErrUnableToGenerate", err)
+	}
+}
+
+func TestGenerateSingleMessage(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	if err := Add(ctx, s, "forsen", "only one way to say this"); err != nil {
+		t.Fatal(err)
+	}
+
+	for size := 1; size <= MAX_STATE_SIZE; size++ {
+		sentence, err := Generate(ctx, s, "forsen", Options{StateSize: size, Seed: "say"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sentence.Text != "only one way to say this" || sentence.Score != 0 {
+			t.Errorf("size %d: got %+v, want the message with a score of 0", size, sentence)
+		}
+	}
+
+	sentence, err := Generate(ctx, s, "forsen", Options{Seed: "say", SeedMode: SEED_START})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sentence.Text != "say this" {
+		t.Errorf("got %q starting with the seed, want \"say this\"", sentence.Text)
+	}
+
+	if _, err := Generate(ctx, s, "forsen", Options{MinScore: 1}); err != ErrUnableToGenerate {
+		t.Errorf("got %v for a score never reached, want ErrUnableToGenerate", err)
+	}
+}
+
+func TestBlend(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	// The weights are per channel, so forsen saying far more does not drown out xqc
+	for i := 0; i < 100; i++ {
+		if err := Add(ctx, s, "forsen", "forsen says hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Add(ctx, s, "xqc", "xqc says bye"); err != nil {
+		t.Fatal(err)
+	}
+
+	sources := []Source{
+		{Channel: "forsen", Store: s, Weight: 1},
+		{Channel: "xqc", Store: s, Weight: 1},
+		{Channel: "pajlada", Store: s, Weight: 1},
+	}
+
+	r := rand.New(rand.NewSource(1))
+	seen := map[string]int{}
+
+	for i := 0; i < 200; i++ {
+		sentence, err := Blend(ctx, sources, Options{Rand: r})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen[sentence.Text]++
+
+		if sentence.Sources["forsen"]+sentence.Sources["xqc"] < len(Words(sentence.Text)) {
+			t.Errorf("%q is not attributed to every word: %v", sentence.Text, sentence.Sources)
+		}
+
+		if sentence.Sources["pajlada"] != 0 {
+			t.Errorf("%q is attributed to a channel without a model", sentence.Text)
+		}
+	}
+
+	if seen["forsen says hi"] < 20 || seen["xqc says bye"] < 20 {
+		t.Errorf("got %v, want both channels to be picked about as often", seen)
+	}
+
+	if seen["forsen says bye"]+seen["xqc says hi"] == 0 {
+		t.Errorf("got %v, want the channels to be mixed through says", seen)
+	}
+
+	sentence, err := Blend(ctx, sources, Options{Seed: "bye", SeedMode: SEED_START, Rand: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sentence.Text != "bye" || len(sentence.Sources) != 0 {
+		t.Errorf("got %+v, want only the seed", sentence)
+	}
+
+	sources[1].Weight = 0
+
+	for i := 0; i < 20; i++ {
+		sentence, err := Blend(ctx, sources, Options{Rand: r})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sentence.Sources["xqc"] != 0 {
+			t.Fatalf("got %+v from xqc without any weight", sentence)
+		}
+	}
+
+	if _, err := Blend(ctx, sources[2:], Options{}); err != ErrNoModel {
+		t.Errorf("got %v from channels without models, want ErrNoModel", err)
+	}
+}
+
+type countingStore struct {
+	Store
+	gets int
+}
+
+func (s *countingStore) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	s.gets++
+	return s.Store.HGetAll(ctx, key)
+}
+
+func TestGenerateLooksUpStatesOnce(t *testing.T) {
+	ctx := context.Background()
+	s := &countingStore{Store: NewMemoryStore()}
+
+	// Said many times, yet there is only one word to pick after every state
+	for i := 0; i < 50; i++ {
+		if err := Add(ctx, s, "forsen", "only one way to say this"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.gets = 0
+
+	if _, err := Generate(ctx, s, "forsen", Options{MinWords: 100, MaxTries: 1000}); err != ErrUnableToGenerate {
+		t.Fatalf("got %v for too many words, want ErrUnableToGenerate", err)
+	}
+
+	// There are only a handful of states, far fewer than the tries walking them
+	if s.gets > 16 {
+		t.Errorf("got %d lookups for 1000 tries, want every state looked up once", s.gets)
+	}
+
+	sentence, err := Generate(ctx, s, "forsen", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sentence.Score != 0 {
+		t.Errorf("got a score of %d, want 0 as no other word could have been picked", sentence.Score)
+	}
+}
@@ -0,0 +1,54 @@
+package markov
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/JoachimFlottorp/magnolia/internal/redis"
+)
+
+// MemoryStore counts like redis.Instance does, for models which are only needed for a moment.
+//
+// It is not safe for concurrent use.
+type MemoryStore struct {
+	hashes map[string]map[string]int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		hashes: make(map[string]map[string]int64),
+	}
+}
+
+func (m *MemoryStore) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	fields := make(map[string]string, len(m.hashes[key]))
+	for field, n := range m.hashes[key] {
+		fields[field] = strconv.FormatInt(n, 10)
+	}
+
+	return fields, nil
+}
+
+func (m *MemoryStore) AdjustCounts(ctx context.Context, deltas []redis.CountDelta) error {
+	for _, d := range deltas {
+		if m.hashes[d.Key] == nil {
+			m.hashes[d.Key] = make(map[string]int64)
+		}
+
+		counts := m.hashes[d.Key]
+		if counts[d.Field] += d.Delta; counts[d.Field] <= 0 {
+			delete(counts, d.Field)
+		}
+
+		if len(counts) == 0 {
+			delete(m.hashes, d.Key)
+		}
+	}
+
+	return nil
+}
+
+// Len returns how many states are counted
+func (m *MemoryStore) Len() int {
+	return len(m.hashes)
+}
@@ -0,0 +1,133 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	archiveTTLIndex = "timestamp_ttl"
+)
+
+// ArchivedMessage is a chat message kept for the long term.
+//
+// Like the chat data in redis it does not say who sent it.
+type ArchivedMessage struct {
+	ID        primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	ChannelID string             `json:"-" bson:"channel_id"`
+	MsgID     string             `json:"id" bson:"msg_id"`
+	Text      string             `json:"text" bson:"text"`
+	Timestamp time.Time          `json:"timestamp" bson:"timestamp"`
+}
+
+// EnsureArchiveIndexes creates the indexes of the archive, messages expire after ttl unless it is 0.
+func EnsureArchiveIndexes(ctx context.Context, i Instance, ttl time.Duration) error {
+	indexes := i.Collection(CollectionArchive).Indexes()
+
+	if _, err := indexes.CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "channel_id", Value: 1}, {Key: "timestamp", Value: 1}},
+	}); err != nil {
+		return err
+	}
+
+	if ttl <= 0 {
+		if _, err := indexes.DropOne(ctx, archiveTTLIndex); err != nil && !isIndexNotFound(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	ttlIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "timestamp", Value: 1}},
+		Options: options.Index().SetName(archiveTTLIndex).SetExpireAfterSeconds(int32(ttl.Seconds())),
+	}
+
+	_, err := indexes.CreateOne(ctx, ttlIndex)
+	if isIndexConflict(err) {
+		// The ttl changed, an index can not be altered so it is created again
+		if _, err := indexes.DropOne(ctx, archiveTTLIndex); err != nil {
+			return err
+		}
+
+		_, err = indexes.CreateOne(ctx, ttlIndex)
+	}
+
+	return err
+}
+
+// ArchiveMessages inserts a batch of messages
+func ArchiveMessages(ctx context.Context, i Instance, messages []ArchivedMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(messages))
+	for idx, msg := range messages {
+		docs[idx] = msg
+	}
+
+	_, err := i.Collection(CollectionArchive).InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+
+	return err
+}
+
+// DeleteArchivedMessages deletes the messages with the given message ids
+func DeleteArchivedMessages(ctx context.Context, i Instance, msgIDs []string) error {
+	if len(msgIDs) == 0 {
+		return nil
+	}
+
+	_, err := i.Collection(CollectionArchive).DeleteMany(ctx, bson.M{
+		"msg_id": bson.M{"$in": msgIDs},
+	})
+
+	return err
+}
+
+// FindArchivedMessages returns up to limit messages of the channel sent in [from, to), oldest first.
+func FindArchivedMessages(ctx context.Context, i Instance, channelID string, from, to time.Time, limit int64) ([]ArchivedMessage, error) {
+	cursor, err := i.Collection(CollectionArchive).Find(ctx, bson.M{
+		"channel_id": channelID,
+		"timestamp": bson.M{
+			"$gte": from,
+			"$lt":  to,
+		},
+	}, options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []ArchivedMessage{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func isIndexConflict(err error) bool {
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+
+	// IndexOptionsConflict and IndexKeySpecsConflict
+	return cmdErr.Code == 85 || cmdErr.Code == 86
+}
+
+func isIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+
+	// IndexNotFound, or NamespaceNotFound before anything was archived
+	return cmdErr.Code == 27 || cmdErr.Code == 26
+}
@@ -15,6 +15,10 @@ type CollectionName string
 const (
 	CollectionAPILog = CollectionName("api_log")
 	CollectionTwitch = CollectionName("twitch")
+	// CollectionIgnoredBots holds the bots admins told the reader to ignore
+	CollectionIgnoredBots = CollectionName("ignored_bots")
+	// CollectionArchive holds chat messages of channels for the long term
+	CollectionArchive = CollectionName("chat_archive")
 )
 
 var ErrNoDocuments = mongo.ErrNoDocuments
@@ -7,6 +7,7 @@ import (
 
 	"github.com/JoachimFlottorp/magnolia/external"
 	"github.com/JoachimFlottorp/magnolia/external/ivr"
+	"github.com/JoachimFlottorp/magnolia/internal/config"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -33,6 +34,21 @@ type TwitchChannel struct {
 	ID         primitive.ObjectID `json:"id" bson:"_id"`
 	TwitchID   string             `json:"twitch_id" bson:"twitch_id"`
 	TwitchName string             `json:"twitch_name" bson:"twitch_name"`
+	// JoinedAt is when the reader last got into the channel
+	JoinedAt *time.Time `json:"joined_at,omitempty" bson:"joined_at,omitempty"`
+	// LastError is why the last join failed, empty if it succeeded
+	LastError string `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	// Filter overrides the configured message filters for this channel
+	Filter *config.FilterConfig `json:"filter,omitempty" bson:"filter,omitempty"`
+	// Retention overrides how much chat data is kept for this channel
+	Retention *Retention `json:"retention,omitempty" bson:"retention,omitempty"`
+}
+
+// Retention limits how much chat data is kept, zero values fall back to the configured defaults
+type Retention struct {
+	MaxMessages int64 `json:"max_messages,omitempty" bson:"max_messages,omitempty"`
+	// MaxAge is in seconds
+	MaxAge int64 `json:"max_age,omitempty" bson:"max_age,omitempty"`
 }
 
 func (t *TwitchChannel) GetByName(ctx context.Context, i Instance) error {
@@ -45,6 +61,23 @@ func (t *TwitchChannel) RemoveChannel(ctx context.Context, i Instance) error {
 	return err
 }
 
+// SetJoinStatus records the outcome of a join, an empty reason means it succeeded.
+func (t *TwitchChannel) SetJoinStatus(ctx context.Context, i Instance, reason string) error {
+	set := bson.M{"last_error": reason}
+
+	if reason == "" {
+		now := time.Now()
+		t.JoinedAt = &now
+		set["joined_at"] = now
+	}
+
+	t.LastError = reason
+
+	_, err := i.Collection(CollectionTwitch).UpdateOne(ctx, bson.M{"twitch_name": t.TwitchName}, bson.M{"$set": set})
+
+	return err
+}
+
 func (t *TwitchChannel) ResolveByIVR(ctx context.Context) error {
 	if t.TwitchName == "" {
 		return ErrMissingName
@@ -78,3 +111,33 @@ func (t *TwitchChannel) Save(ctx context.Context, i Instance) error {
 
 	return err
 }
+
+type IgnoredBot struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id"`
+	Name    string             `json:"name" bson:"name"`
+	AddedBy string             `json:"added_by" bson:"added_by"`
+	AddedAt time.Time          `json:"added_at" bson:"added_at"`
+}
+
+// Save adds the bot, adding one that is already ignored does nothing.
+func (b *IgnoredBot) Save(ctx context.Context, i Instance) error {
+	if b.ID.IsZero() {
+		b.ID = primitive.NewObjectID()
+	}
+
+	p := true
+
+	_, err := i.Collection(CollectionIgnoredBots).UpdateOne(ctx, bson.M{"name": b.Name}, bson.M{
+		"$setOnInsert": b,
+	}, &options.UpdateOptions{
+		Upsert: &p,
+	})
+
+	return err
+}
+
+func (b *IgnoredBot) Remove(ctx context.Context, i Instance) error {
+	_, err := i.Collection(CollectionIgnoredBots).DeleteOne(ctx, bson.M{"name": b.Name})
+
+	return err
+}
@@ -2,6 +2,8 @@ package rabbitmq
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/rabbitmq/amqp091-go"
 )
@@ -22,8 +24,25 @@ const (
 	QueueJoinRequest       = QueueName("twitch-join-request")
 	QueuePartRequest       = QueueName("twitch-part-request")
 	QueueMarkovGenenerator = QueueName("markov-generator")
+	QueueChatBotMessages   = QueueName("chat-bot-messages")
+
+	// ExchangeTwitchMessages is a topic exchange every stored chat message is published to, see TwitchMessageKey
+	ExchangeTwitchMessages = "twitch-messages"
+	// ExchangeTwitchShards is a direct exchange routing join and part requests to the twitch-reader owning the channel
+	ExchangeTwitchShards = "twitch-shards"
 )
 
+// ShardQueue is the queue of a twitch-reader shard, bound to ExchangeTwitchShards by its id
+func ShardQueue(id string) QueueName {
+	return QueueName(fmt.Sprintf("twitch-reader.%s", id))
+}
+
+// TwitchMessageKey is the routing key of chat messages from the channel,
+// bind to twitch.* for every channel.
+func TwitchMessageKey(channel string) string {
+	return fmt.Sprintf("twitch.%s", channel)
+}
+
 type PublishSettings struct {
 	Exchange   string
 	RoutingKey QueueName
@@ -33,10 +52,18 @@ type PublishSettings struct {
 type ConsumeSettings struct {
 	Queue    QueueName
 	Consumer string
+	// ManualAck leaves acknowledging deliveries to the consumer,
+	// so a message which was not handled is delivered again.
+	ManualAck bool
+	// Expires is passed on to the queue, see QueueSettings
+	Expires time.Duration
 }
 
 type QueueSettings struct {
 	Name QueueName
+	// Expires deletes the queue once it has had no consumers for this long, zero keeps it forever.
+	// A queue must always be declared with the same Expires.
+	Expires time.Duration
 }
 
 type ExchangeSettings struct {
@@ -56,8 +83,12 @@ type NewInstanceSettings struct {
 
 type Instance interface {
 	Publish(context.Context, PublishSettings) error
+	// PublishDeferred publishes on a channel in confirm mode, the confirmation tells whether the broker took the message
+	PublishDeferred(context.Context, PublishSettings) (*amqp091.DeferredConfirmation, error)
 	CreateQueue(context.Context, QueueSettings) (amqp091.Queue, error)
 	CreateExchange(context.Context, ExchangeSettings) error
 	BindQueue(context.Context, BindingSettings) error
 	Consume(context.Context, ConsumeSettings) (chan *amqp091.Delivery, error)
+	// NewRPCClient creates a client for request and reply over queues, see RPCClient
+	NewRPCClient(context.Context) (*RPCClient, error)
 }
@@ -3,58 +3,142 @@ package rabbitmq
 import (
 	"context"
 	"errors"
+	"sync"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 	"go.uber.org/zap"
 )
 
+const (
+	REDIAL_MIN = time.Second
+	REDIAL_MAX = 30 * time.Second
+)
+
 var (
 	ErrNotDeclared = errors.New("queue not declared")
 )
 
 type rabbitmqInstance struct {
+	address string
+
+	// mtx guards the connection, which is replaced when the broker drops it
+	mtx     sync.RWMutex
 	conn    *amqp.Connection
 	channel *amqp.Channel
-	isOpen  chan *amqp.Error
+	// isOpen is closed once conn closes, a new one is made with the next connection
+	isOpen chan struct{}
+
+	// confirm is opened by the first PublishDeferred, and again after it closes
+	confirmMtx sync.Mutex
+	confirm    *amqp.Channel
 }
 
 func New(ctx context.Context, opts *NewInstanceSettings) (Instance, error) {
-	conn, err := amqp.Dial(opts.Address)
-	if err != nil {
-		return nil, err
+	r := &rabbitmqInstance{
+		address: opts.Address,
 	}
 
-	ch, err := conn.Channel()
-	if err != nil {
+	if err := r.dial(ctx); err != nil {
 		return nil, err
 	}
 
 	go func() {
 		<-ctx.Done()
+
+		conn, ch, _ := r.current()
 		ch.Close()
 		conn.Close()
 	}()
 
-	return &rabbitmqInstance{
-		conn:    conn,
-		channel: ch,
-		isOpen:  conn.NotifyClose(make(chan *amqp.Error)),
-	}, nil
+	return r, nil
+}
+
+// dial opens the connection and redials it in the background whenever it closes, until the context is done
+func (r *rabbitmqInstance) dial(ctx context.Context) error {
+	conn, err := amqp.Dial(r.address)
+	if err != nil {
+		return err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	isOpen := make(chan struct{})
+
+	r.mtx.Lock()
+	r.conn, r.channel, r.isOpen = conn, ch, isOpen
+	r.mtx.Unlock()
+
+	go func() {
+		err := <-closed
+		close(isOpen)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		zap.S().Warnw("RabbitMQ connection closed, redialing", "error", err)
+
+		wait := REDIAL_MIN
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+
+			err := r.dial(ctx)
+			if err == nil {
+				zap.S().Info("Reconnected to RabbitMQ")
+				return
+			}
+
+			zap.S().Errorw("Failed to redial RabbitMQ", "error", err, "in", wait)
+
+			if wait *= 2; wait > REDIAL_MAX {
+				wait = REDIAL_MAX
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (r *rabbitmqInstance) current() (*amqp.Connection, *amqp.Channel, chan struct{}) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.conn, r.channel, r.isOpen
 }
 
 func (r *rabbitmqInstance) CreateQueue(ctx context.Context, opts QueueSettings) (amqp.Queue, error) {
-	return r.channel.QueueDeclare(
+	_, ch, _ := r.current()
+
+	var args amqp.Table
+	if opts.Expires > 0 {
+		args = amqp.Table{"x-expires": opts.Expires.Milliseconds()}
+	}
+
+	return ch.QueueDeclare(
 		opts.Name.String(),
 		true,
 		false,
 		false,
 		false,
-		nil,
+		args,
 	)
 }
 
 func (r *rabbitmqInstance) CreateExchange(ctx context.Context, opts ExchangeSettings) error {
-	return r.channel.ExchangeDeclare(
+	_, ch, _ := r.current()
+
+	return ch.ExchangeDeclare(
 		opts.Name,
 		string(opts.Type),
 		true,
@@ -66,7 +150,9 @@ func (r *rabbitmqInstance) CreateExchange(ctx context.Context, opts ExchangeSett
 }
 
 func (r *rabbitmqInstance) BindQueue(ctx context.Context, opts BindingSettings) error {
-	return r.channel.QueueBind(
+	_, ch, _ := r.current()
+
+	return ch.QueueBind(
 		opts.Name,
 		opts.RoutingKey,
 		opts.Exchange,
@@ -76,7 +162,9 @@ func (r *rabbitmqInstance) BindQueue(ctx context.Context, opts BindingSettings)
 }
 
 func (r *rabbitmqInstance) Publish(ctx context.Context, opts PublishSettings) error {
-	err := r.channel.PublishWithContext(
+	_, ch, _ := r.current()
+
+	err := ch.PublishWithContext(
 		ctx,
 		opts.Exchange,
 		opts.RoutingKey.String(),
@@ -92,25 +180,41 @@ func (r *rabbitmqInstance) Publish(ctx context.Context, opts PublishSettings) er
 	return err
 }
 
-func (r *rabbitmqInstance) Consume(ctx context.Context, opts ConsumeSettings) (chan *amqp.Delivery, error) {
-	_, err := r.CreateQueue(ctx, QueueSettings{
-		Name: opts.Queue,
-	})
+func (r *rabbitmqInstance) PublishDeferred(ctx context.Context, opts PublishSettings) (*amqp.DeferredConfirmation, error) {
+	r.confirmMtx.Lock()
+	defer r.confirmMtx.Unlock()
 
-	if err != nil {
-		return nil, err
+	if r.confirm == nil || r.confirm.IsClosed() {
+		conn, _, _ := r.current()
+
+		ch, err := conn.Channel()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ch.Confirm(false); err != nil {
+			ch.Close()
+			return nil, err
+		}
+
+		r.confirm = ch
 	}
 
-	msgs, err := r.channel.Consume(
-		opts.Queue.String(),
-		opts.Consumer,
-		false,
-		false,
+	return r.confirm.PublishWithDeferredConfirmWithContext(
+		ctx,
+		opts.Exchange,
+		opts.RoutingKey.String(),
 		false,
 		false,
-		nil,
+		opts.Msg,
 	)
+}
 
+// Consume delivers the messages of the queue until the context is done.
+//
+// When the connection drops the queue is consumed again once it is redialed, so the channel stays open.
+func (r *rabbitmqInstance) Consume(ctx context.Context, opts ConsumeSettings) (chan *amqp.Delivery, error) {
+	msgs, isOpen, err := r.consume(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -118,20 +222,32 @@ func (r *rabbitmqInstance) Consume(ctx context.Context, opts ConsumeSettings) (c
 	out := make(chan *amqp.Delivery, 50)
 
 	go func() {
+		defer close(out)
+
 		for {
 			select {
 			case <-ctx.Done():
-				close(out)
-				return
-			case <-r.isOpen:
-				zap.S().Warn("RabbitMQ connection closed")
-				close(out)
 				return
+			case <-isOpen:
+				{
+					zap.S().Warnw("RabbitMQ connection closed, consuming again once it is back", "queue", opts.Queue)
+
+					if msgs, isOpen, err = r.reconsume(ctx, opts); err != nil {
+						return
+					}
+				}
 			case msg, ok := <-msgs:
 				{
 					if !ok {
+						// The deliveries also stop when the connection closes, which is consumed again above
+						select {
+						case <-isOpen:
+							msgs = nil
+							continue
+						case <-time.After(REDIAL_MIN):
+						}
+
 						zap.S().Errorw("Channel is not ok", "queue", opts.Queue)
-						close(out)
 						return
 					}
 
@@ -141,7 +257,9 @@ func (r *rabbitmqInstance) Consume(ctx context.Context, opts ConsumeSettings) (c
 
 					out <- &msg
 
-					msg.Ack(false)
+					if !opts.ManualAck {
+						msg.Ack(false)
+					}
 				}
 			}
 		}
@@ -149,3 +267,60 @@ func (r *rabbitmqInstance) Consume(ctx context.Context, opts ConsumeSettings) (c
 
 	return out, nil
 }
+
+func (r *rabbitmqInstance) consume(ctx context.Context, opts ConsumeSettings) (<-chan amqp.Delivery, chan struct{}, error) {
+	_, ch, isOpen := r.current()
+
+	_, err := r.CreateQueue(ctx, QueueSettings{
+		Name:    opts.Queue,
+		Expires: opts.Expires,
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msgs, err := ch.Consume(
+		opts.Queue.String(),
+		opts.Consumer,
+		false,
+		false,
+		false,
+		false,
+		nil,
+	)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return msgs, isOpen, nil
+}
+
+// reconsume waits for the connection to be redialed and consumes the queue on it, until the context is done
+func (r *rabbitmqInstance) reconsume(ctx context.Context, opts ConsumeSettings) (<-chan amqp.Delivery, chan struct{}, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(REDIAL_MIN):
+		}
+
+		_, _, isOpen := r.current()
+
+		select {
+		case <-isOpen:
+			// Still the connection which closed
+			continue
+		default:
+		}
+
+		msgs, isOpen, err := r.consume(ctx, opts)
+		if err != nil {
+			zap.S().Errorw("Failed to consume queue again", "queue", opts.Queue, "error", err)
+			continue
+		}
+
+		return msgs, isOpen, nil
+	}
+}
@@ -0,0 +1,171 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrRPCClosed = errors.New("rpc client is closed")
+)
+
+// RPCClient sends requests to a queue and waits for the replies on an exclusive queue of its own.
+//
+// Whoever handles the request has to publish the reply to the ReplyTo queue of the request,
+// with the same CorrelationId.
+type RPCClient struct {
+	channel *amqp.Channel
+	replyTo string
+	pending *correlations
+	done    chan struct{}
+}
+
+// NewRPCClient opens a channel with an exclusive reply queue, which is deleted when the context is done.
+func (r *rabbitmqInstance) NewRPCClient(ctx context.Context) (*RPCClient, error) {
+	conn, _, _ := r.current()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := ch.QueueDeclare(
+		"",
+		false,
+		true,
+		true,
+		false,
+		nil,
+	)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	replies, err := ch.Consume(
+		q.Name,
+		"",
+		true,
+		true,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	c := &RPCClient{
+		channel: ch,
+		replyTo: q.Name,
+		pending: newCorrelations(),
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		<-ctx.Done()
+		ch.Close()
+	}()
+
+	go c.dispatch(replies)
+
+	return c, nil
+}
+
+// Done is closed once the client's channel closed, calls only fail from then on and a new client is needed
+func (c *RPCClient) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *RPCClient) dispatch(replies <-chan amqp.Delivery) {
+	defer close(c.done)
+
+	for reply := range replies {
+		if !c.pending.resolve(reply.CorrelationId, reply) {
+			zap.S().Debugw("Dropped reply nobody is waiting for", "correlation_id", reply.CorrelationId)
+		}
+	}
+}
+
+// Call publishes msg to the queue and returns the reply, it gives up once the context is done.
+func (c *RPCClient) Call(ctx context.Context, queue QueueName, msg amqp.Publishing) (amqp.Delivery, error) {
+	id := uuid.NewString()
+
+	reply := c.pending.register(id)
+	defer c.pending.remove(id)
+
+	msg.CorrelationId = id
+	msg.ReplyTo = c.replyTo
+
+	if err := c.channel.PublishWithContext(ctx, "", queue.String(), false, false, msg); err != nil {
+		return amqp.Delivery{}, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return amqp.Delivery{}, ctx.Err()
+	case <-c.done:
+		return amqp.Delivery{}, ErrRPCClosed
+	case d := <-reply:
+		return d, nil
+	}
+}
+
+// correlations are the calls waiting for a reply by correlation id
+type correlations struct {
+	mtx   sync.Mutex
+	calls map[string]chan amqp.Delivery
+}
+
+func newCorrelations() *correlations {
+	return &correlations{
+		calls: make(map[string]chan amqp.Delivery),
+	}
+}
+
+func (c *correlations) register(id string) <-chan amqp.Delivery {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// Buffered so a reply is never blocked on a caller which is giving up
+	ch := make(chan amqp.Delivery, 1)
+	c.calls[id] = ch
+
+	return ch
+}
+
+// resolve hands the reply to the call waiting for it, false if nobody is waiting anymore
+func (c *correlations) resolve(id string, d amqp.Delivery) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	ch, ok := c.calls[id]
+	if !ok {
+		return false
+	}
+
+	delete(c.calls, id)
+	ch <- d
+
+	return true
+}
+
+func (c *correlations) remove(id string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	delete(c.calls, id)
+}
+
+func (c *correlations) waiting() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return len(c.calls)
+}
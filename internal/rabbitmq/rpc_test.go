@@ -0,0 +1,67 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestCorrelations(t *testing.T) {
+	c := newCorrelations()
+
+	reply := c.register("a")
+
+	if !c.resolve("a", amqp.Delivery{Body: []byte("forsen")}) {
+		t.Fatal("reply was not handed to the waiting call")
+	}
+
+	if d := <-reply; string(d.Body) != "forsen" {
+		t.Errorf("got body %q, want forsen", d.Body)
+	}
+
+	// A second reply with the same id, or one for a call that gave up, is dropped
+	if c.resolve("a", amqp.Delivery{}) {
+		t.Errorf("resolved a call twice")
+	}
+
+	c.register("b")
+	c.remove("b")
+
+	if c.resolve("b", amqp.Delivery{}) {
+		t.Errorf("resolved a removed call")
+	}
+
+	if n := c.waiting(); n != 0 {
+		t.Errorf("%d calls left waiting, want 0", n)
+	}
+}
+
+func TestCorrelationsConcurrent(t *testing.T) {
+	c := newCorrelations()
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+
+		go func(id string) {
+			defer wg.Done()
+
+			reply := c.register(id)
+			defer c.remove(id)
+
+			go c.resolve(id, amqp.Delivery{CorrelationId: id})
+
+			if d := <-reply; d.CorrelationId != id {
+				t.Errorf("got reply for %s, want %s", d.CorrelationId, id)
+			}
+		}(fmt.Sprint(i))
+	}
+
+	wg.Wait()
+
+	if n := c.waiting(); n != 0 {
+		t.Errorf("%d calls left waiting, want 0", n)
+	}
+}
@@ -14,6 +14,15 @@ type Options struct {
 	DB       int
 }
 
+// CountDelta changes a count in a hash of counts, such as the words after a state of a markov chain.
+//
+// Fields whose count drops to 0 are deleted, and with the last of them the hash.
+type CountDelta struct {
+	Key   string
+	Field string
+	Delta int64
+}
+
 type Instance interface {
 	// Ping checks if the redis instance is alive
 	Ping(context.Context) error
@@ -24,20 +33,52 @@ type Instance interface {
 	//
 	// No expiration is set
 	Set(context.Context, string, string) error
+	// SetEx sets the value of the key, which expires after the duration
+	SetEx(context.Context, string, string, time.Duration) error
 	// Del deletes the key
 	Del(context.Context, string) error
 	// Expire sets the expiration of the key
 	Expire(context.Context, string, time.Duration) error
-	Keys(context.Context, string) ([]string, error)
+	// Scan calls fn with every key matching the pattern, without the prefix.
+	//
+	// The keys are walked a batch at a time, so unlike KEYS it does not block redis on a large keyspace
+	Scan(ctx context.Context, pattern string, fn func(key string) error) error
 
 	// Add a value to a set
 	LPush(context.Context, string, string) error
 	LRPop(context.Context, string) error
+	// LRem removes count occurrences of the value from a list, 0 removes every occurrence.
+	// It returns how many were removed
+	LRem(context.Context, string, int64, string) (int64, error)
 
 	LLen(context.Context, string) (int64, error)
+	// LIndex returns the element at the index of a list, negative indexes count from the end
+	LIndex(context.Context, string, int64) (string, error)
+	// LTrim keeps only the first max elements of a list and returns the trimmed ones
+	LTrim(context.Context, string, int64) ([]string, error)
+	// LPushTrim pushes a value and trims the list to max elements in a single transaction,
+	// it returns the trimmed elements
+	LPushTrim(ctx context.Context, key string, value string, max int64) ([]string, error)
+	// RPopOlderThan pops elements from the end of a list while they are JSON objects
+	// whose numeric field is below cutoff, it returns the popped elements
+	RPopOlderThan(ctx context.Context, key string, field string, cutoff int64) ([]string, error)
 
 	GetAllList(context.Context, string) ([]string, error)
 
+	// ZAdd adds the member to a sorted set, or changes its score
+	ZAdd(ctx context.Context, key string, member string, score float64) error
+	// ZRem removes the member from a sorted set
+	ZRem(ctx context.Context, key string, member string) error
+	// ZRangeByScore returns the members of a sorted set scored between min and max, lowest first
+	ZRangeByScore(ctx context.Context, key string, min, max float64) ([]string, error)
+	// ZRemRangeByScore removes the members of a sorted set scored between min and max
+	ZRemRangeByScore(ctx context.Context, key string, min, max float64) error
+
+	// HGetAll returns every field of a hash, none if the hash does not exist
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	// AdjustCounts applies the deltas in a single script, see CountDelta
+	AdjustCounts(ctx context.Context, deltas []CountDelta) error
+
 	Subscribe(context.Context, string) (chan string, error)
 	Publish(context.Context, string, interface{}) error
 
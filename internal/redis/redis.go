@@ -3,12 +3,18 @@ package redis
 import (
 	"context"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 )
 
+// SCAN_COUNT is how many keys Scan asks redis to look at in each batch
+const SCAN_COUNT = 1000
+
 type redisInstance struct {
 	client *redis.Client
 }
@@ -52,12 +58,24 @@ func (r *redisInstance) Set(ctx context.Context, key string, value string) error
 	return r.client.Set(ctx, r.formatKey(key), value, 0).Err()
 }
 
+func (r *redisInstance) SetEx(ctx context.Context, key string, value string, expiration time.Duration) error {
+	return r.client.Set(ctx, r.formatKey(key), value, expiration).Err()
+}
+
 func (r *redisInstance) Del(ctx context.Context, key string) error {
 	return r.client.Del(ctx, r.formatKey(key)).Err()
 }
 
-func (r *redisInstance) Keys(ctx context.Context, pattern string) ([]string, error) {
-	return r.client.Keys(ctx, r.formatKey(pattern)).Result()
+func (r *redisInstance) Scan(ctx context.Context, pattern string, fn func(key string) error) error {
+	iter := r.client.Scan(ctx, 0, r.formatKey(pattern), SCAN_COUNT).Iterator()
+
+	for iter.Next(ctx) {
+		if err := fn(strings.TrimPrefix(iter.Val(), r.Prefix())); err != nil {
+			return err
+		}
+	}
+
+	return iter.Err()
 }
 
 func (r *redisInstance) Expire(ctx context.Context, key string, expiration time.Duration) error {
@@ -72,6 +90,80 @@ func (r *redisInstance) LRPop(ctx context.Context, key string) error {
 	return r.client.RPop(ctx, r.formatKey(key)).Err()
 }
 
+func (r *redisInstance) LRem(ctx context.Context, key string, count int64, value string) (int64, error) {
+	return r.client.LRem(ctx, r.formatKey(key), count, value).Result()
+}
+
+func (r *redisInstance) LIndex(ctx context.Context, key string, index int64) (string, error) {
+	return r.client.LIndex(ctx, r.formatKey(key), index).Result()
+}
+
+func (r *redisInstance) LTrim(ctx context.Context, key string, max int64) ([]string, error) {
+	key = r.formatKey(key)
+
+	var trimmed *redis.StringSliceCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		trimmed = pipe.LRange(ctx, key, max, -1)
+		pipe.LTrim(ctx, key, 0, max-1)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trimmed.Val(), nil
+}
+
+func (r *redisInstance) LPushTrim(ctx context.Context, key string, value string, max int64) ([]string, error) {
+	key = r.formatKey(key)
+
+	var trimmed *redis.StringSliceCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, value)
+		trimmed = pipe.LRange(ctx, key, max, -1)
+		pipe.LTrim(ctx, key, 0, max-1)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trimmed.Val(), nil
+}
+
+// rPopOlderThan stops at the first element which is not a JSON object with the field,
+// as its age can not be told
+var rPopOlderThan = redis.NewScript(`
+local popped = {}
+
+while true do
+	local last = redis.call("LINDEX", KEYS[1], -1)
+	if not last then
+		break
+	end
+
+	local ok, decoded = pcall(cjson.decode, last)
+	if not ok or type(decoded) ~= "table" or type(decoded[ARGV[1]]) ~= "number" or decoded[ARGV[1]] >= tonumber(ARGV[2]) then
+		break
+	end
+
+	table.insert(popped, redis.call("RPOP", KEYS[1]))
+end
+
+return popped
+`)
+
+func (r *redisInstance) RPopOlderThan(ctx context.Context, key string, field string, cutoff int64) ([]string, error) {
+	popped, err := rPopOlderThan.Run(ctx, r.client, []string{r.formatKey(key)}, field, cutoff).StringSlice()
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	return popped, err
+}
+
 func (r *redisInstance) LLen(ctx context.Context, key string) (int64, error) {
 	return r.client.LLen(ctx, r.formatKey(key)).Result()
 }
@@ -86,6 +178,80 @@ func (r *redisInstance) GetAllList(ctx context.Context, key string) ([]string, e
 	return a, e
 }
 
+func (r *redisInstance) ZAdd(ctx context.Context, key string, member string, score float64) error {
+	return r.client.ZAdd(ctx, r.formatKey(key), &redis.Z{Score: score, Member: member}).Err()
+}
+
+func (r *redisInstance) ZRem(ctx context.Context, key string, member string) error {
+	return r.client.ZRem(ctx, r.formatKey(key), member).Err()
+}
+
+func (r *redisInstance) ZRangeByScore(ctx context.Context, key string, min, max float64) ([]string, error) {
+	return r.client.ZRangeByScore(ctx, r.formatKey(key), &redis.ZRangeBy{
+		Min: formatScore(min),
+		Max: formatScore(max),
+	}).Result()
+}
+
+func (r *redisInstance) ZRemRangeByScore(ctx context.Context, key string, min, max float64) error {
+	return r.client.ZRemRangeByScore(ctx, r.formatKey(key), formatScore(min), formatScore(max)).Err()
+}
+
+// formatScore formats a score for a range, infinity is written the way redis expects it
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "+inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(score, 'f', -1, 64)
+	}
+}
+
+func (r *redisInstance) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return r.client.HGetAll(ctx, r.formatKey(key)).Result()
+}
+
+// adjustCounts increments every count on its own, so a delta costs the same however many fields the hash has.
+//
+// The arguments are groups of key index, field and delta.
+var adjustCounts = redis.NewScript(`
+for i = 1, #ARGV, 3 do
+	local key = KEYS[tonumber(ARGV[i])]
+	local field = ARGV[i + 1]
+
+	if redis.call("HINCRBY", key, field, ARGV[i + 2]) <= 0 then
+		redis.call("HDEL", key, field)
+	end
+end
+
+return #ARGV / 3
+`)
+
+func (r *redisInstance) AdjustCounts(ctx context.Context, deltas []CountDelta) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	keys := []string{}
+	index := map[string]int{}
+	args := make([]interface{}, 0, len(deltas)*3)
+
+	for _, d := range deltas {
+		i, ok := index[d.Key]
+		if !ok {
+			keys = append(keys, r.formatKey(d.Key))
+			i = len(keys)
+			index[d.Key] = i
+		}
+
+		args = append(args, i, d.Field, d.Delta)
+	}
+
+	return adjustCounts.Run(ctx, r.client, keys, args...).Err()
+}
+
 func (r *redisInstance) Subscribe(ctx context.Context, key string) (chan string, error) {
 	sub := r.client.Subscribe(ctx, r.formatKey(key))
 
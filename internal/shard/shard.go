@@ -0,0 +1,251 @@
+// Package shard spreads channels over the twitch-reader instances which are running.
+//
+// Every instance keeps a heartbeat in redis and its id in a sorted set scored by when it
+// last beat, the channels are divided between the
+// instances with a live heartbeat by rendezvous hashing. When an instance stops beating
+// its channels are picked up by the others, and only those channels move.
+package shard
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/redis"
+	goredis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	HEARTBEAT_INTERVAL = 10 * time.Second
+	// HEARTBEAT_TTL is how long a shard is considered alive after its last heartbeat
+	HEARTBEAT_TTL = 30 * time.Second
+
+	keyPrefix = "twitch:shards:"
+	// liveKey is the sorted set of shard ids, scored by the unix milliseconds of their last heartbeat
+	liveKey = "twitch:shards"
+)
+
+// Heartbeat is what a shard stores in redis about itself
+type Heartbeat struct {
+	ID        string    `json:"id"`
+	StartedAt time.Time `json:"started_at"`
+	SeenAt    time.Time `json:"seen_at"`
+	// Channels is how many channels the shard is in
+	Channels int `json:"channels"`
+}
+
+func key(id string) string {
+	return keyPrefix + id
+}
+
+// Owner returns which of the shards owns the channel, the shard with the highest hash of the pair wins.
+func Owner(channel string, shards []string) string {
+	var (
+		owner string
+		best  uint64
+	)
+
+	for _, id := range shards {
+		h := fnv.New64a()
+		h.Write([]byte(id))
+		h.Write([]byte{0})
+		h.Write([]byte(channel))
+
+		if score := mix(h.Sum64()); owner == "" || score > best || (score == best && id < owner) {
+			owner = id
+			best = score
+		}
+	}
+
+	return owner
+}
+
+// mix spreads the bits of an FNV hash, which on its own favours some shards for similar channel names
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	return h
+}
+
+// Live returns the heartbeats of every shard which is alive, ordered by id.
+func Live(ctx context.Context, i redis.Instance) ([]Heartbeat, error) {
+	cutoff := float64(time.Now().Add(-HEARTBEAT_TTL).UnixMilli())
+
+	// Shards which stopped without leaving are forgotten once their heartbeat is too old
+	if err := i.ZRemRangeByScore(ctx, liveKey, math.Inf(-1), cutoff); err != nil {
+		return nil, err
+	}
+
+	ids, err := i.ZRangeByScore(ctx, liveKey, cutoff, math.Inf(1))
+	if err != nil {
+		return nil, err
+	}
+
+	heartbeats := make([]Heartbeat, 0, len(ids))
+
+	for _, id := range ids {
+		data, err := i.Get(ctx, key(id))
+		if err == goredis.Nil {
+			// Expired since it was listed
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var hb Heartbeat
+		if err := json.Unmarshal([]byte(data), &hb); err != nil {
+			zap.S().Warnw("Invalid shard heartbeat", "shard", id, "error", err)
+			continue
+		}
+
+		heartbeats = append(heartbeats, hb)
+	}
+
+	sort.Slice(heartbeats, func(a, b int) bool {
+		return heartbeats[a].ID < heartbeats[b].ID
+	})
+
+	return heartbeats, nil
+}
+
+// Member is the shard of this instance
+type Member struct {
+	inst      redis.Instance
+	id        string
+	startedAt time.Time
+	channels  func() int
+
+	mtx    sync.RWMutex
+	shards []string
+}
+
+// NewMember creates the shard id, channels reports how many channels it is in.
+func NewMember(i redis.Instance, id string, channels func() int) *Member {
+	return &Member{
+		inst:      i,
+		id:        id,
+		startedAt: time.Now(),
+		channels:  channels,
+		shards:    []string{id},
+	}
+}
+
+func (m *Member) ID() string {
+	return m.id
+}
+
+// Shards returns the ids of the live shards
+func (m *Member) Shards() []string {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return append([]string{}, m.shards...)
+}
+
+// Owner returns the id of the shard owning the channel
+func (m *Member) Owner(channel string) string {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return Owner(channel, m.shards)
+}
+
+// Owns reports if this shard owns the channel
+func (m *Member) Owns(channel string) bool {
+	return m.Owner(channel) == m.id
+}
+
+// Beat stores the heartbeat and refreshes the live shards, it reports if they changed.
+func (m *Member) Beat(ctx context.Context) (bool, error) {
+	now := time.Now()
+
+	data, err := json.Marshal(Heartbeat{
+		ID:        m.id,
+		StartedAt: m.startedAt,
+		SeenAt:    now,
+		Channels:  m.channels(),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err := m.inst.SetEx(ctx, key(m.id), string(data), HEARTBEAT_TTL); err != nil {
+		return false, err
+	}
+
+	if err := m.inst.ZAdd(ctx, liveKey, m.id, float64(now.UnixMilli())); err != nil {
+		return false, err
+	}
+
+	live, err := Live(ctx, m.inst)
+	if err != nil {
+		return false, err
+	}
+
+	shards := []string{m.id}
+	for _, hb := range live {
+		if hb.ID != m.id {
+			shards = append(shards, hb.ID)
+		}
+	}
+
+	sort.Strings(shards)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	changed := strings.Join(shards, ",") != strings.Join(m.shards, ",")
+	m.shards = shards
+
+	return changed, nil
+}
+
+// Run beats every HEARTBEAT_INTERVAL and calls onChange when shards come or go.
+//
+// Once the context is done the heartbeat is removed, so the other shards take over right away.
+func (m *Member) Run(ctx context.Context, onChange func(shards []string)) {
+	ticker := time.NewTicker(HEARTBEAT_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			{
+				leaveCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+
+				if err := m.inst.ZRem(leaveCtx, liveKey, m.id); err != nil {
+					zap.S().Warnw("Failed to remove shard heartbeat", "shard", m.id, "error", err)
+				}
+
+				if err := m.inst.Del(leaveCtx, key(m.id)); err != nil {
+					zap.S().Warnw("Failed to remove shard heartbeat", "shard", m.id, "error", err)
+				}
+
+				return
+			}
+		case <-ticker.C:
+			{
+				changed, err := m.Beat(ctx)
+				if err != nil {
+					zap.S().Errorw("Failed to send shard heartbeat", "shard", m.id, "error", err)
+					continue
+				}
+
+				if changed {
+					onChange(m.Shards())
+				}
+			}
+		}
+	}
+}
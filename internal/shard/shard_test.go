@@ -0,0 +1,69 @@
+package shard
+
+import (
+	"fmt"
+	"testing"
+)
+
+func channels(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("channel%d", i)
+	}
+
+	return names
+}
+
+func TestOwnerIsStable(t *testing.T) {
+	shards := []string{"a", "b", "c"}
+	reversed := []string{"c", "b", "a"}
+
+	for _, channel := range channels(100) {
+		if Owner(channel, shards) != Owner(channel, reversed) {
+			t.Fatalf("%s: owner depends on the order of the shards", channel)
+		}
+	}
+
+	if owner := Owner("forsen", nil); owner != "" {
+		t.Errorf("got owner %q without shards", owner)
+	}
+}
+
+func TestOwnerSpreadsChannels(t *testing.T) {
+	shards := []string{"a", "b", "c", "d"}
+	counts := make(map[string]int)
+
+	for _, channel := range channels(4000) {
+		counts[Owner(channel, shards)]++
+	}
+
+	for _, id := range shards {
+		if counts[id] < 800 || counts[id] > 1200 {
+			t.Errorf("shard %s owns %d of 4000 channels, want about 1000", id, counts[id])
+		}
+	}
+}
+
+func TestOwnerOnlyMovesChannelsOfChangedShard(t *testing.T) {
+	before := []string{"a", "b", "c"}
+	after := []string{"a", "b", "c", "d"}
+
+	for _, channel := range channels(1000) {
+		old, updated := Owner(channel, before), Owner(channel, after)
+
+		if old != updated && updated != "d" {
+			t.Errorf("%s moved from %s to %s, only moves to the new shard are expected", channel, old, updated)
+		}
+	}
+
+	// Removing c only moves the channels c owned
+	without := []string{"a", "b"}
+
+	for _, channel := range channels(1000) {
+		old, updated := Owner(channel, before), Owner(channel, without)
+
+		if old != updated && old != "c" {
+			t.Errorf("%s moved from %s to %s, only channels of the removed shard are expected to move", channel, old, updated)
+		}
+	}
+}
@@ -6,7 +6,9 @@ import (
 
 	"github.com/JoachimFlottorp/magnolia/internal/ctx"
 	"github.com/JoachimFlottorp/magnolia/internal/web/router"
+	"github.com/JoachimFlottorp/magnolia/internal/web/routes/api/archive"
 	"github.com/JoachimFlottorp/magnolia/internal/web/routes/api/markov"
+	"github.com/JoachimFlottorp/magnolia/internal/web/routes/api/shards"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -31,6 +33,8 @@ func (a *Route) Configure() router.RouteConfig {
 		Method: []string{http.MethodGet},
 		Children: []router.RouteInitializerFunc{
 			markov.NewGetRoute,
+			archive.NewGetRoute,
+			shards.NewGetRoute,
 		},
 	}
 }
@@ -0,0 +1,154 @@
+package archive
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/internal/mongo"
+	"github.com/JoachimFlottorp/magnolia/internal/web/router"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	DEFAULT_LIMIT = 1000
+	MAX_LIMIT     = 5000
+)
+
+// swagger:model ArchiveResponse
+type ArchiveResponse struct {
+	// The channel the messages were sent in
+	// in: body
+	Channel string `json:"channel"`
+	// The archived messages, oldest first
+	// in: body
+	Messages []mongo.ArchivedMessage `json:"messages"`
+}
+
+// swagger:parameters archiveGet
+type ArchiveGetParams struct {
+	// in: query
+	// description: The channel to get archived messages from
+	// required: true
+	// type: string
+	Channel string `json:"channel"`
+	// in: query
+	// description: Start of the range, RFC3339 or unix milliseconds. Defaults to 24 hours before to
+	// required: false
+	// type: string
+	From string `json:"from"`
+	// in: query
+	// description: End of the range, RFC3339 or unix milliseconds. Defaults to now
+	// required: false
+	// type: string
+	To string `json:"to"`
+	// in: query
+	// description: The most messages to return, at most 5000
+	// required: false
+	// type: integer
+	Limit int64 `json:"limit"`
+}
+
+type ArchiveRoute struct {
+	Ctx ctx.Context
+}
+
+func NewGetRoute(gCtx ctx.Context) router.Route {
+	return &ArchiveRoute{gCtx}
+}
+
+func (a *ArchiveRoute) Configure() router.RouteConfig {
+	return router.RouteConfig{
+		URI:    "/archive",
+		Method: []string{http.MethodGet},
+	}
+}
+
+// swagger:route GET /api/archive archive archiveGet
+//
+// Get the archived messages of a channel within a time range
+//
+//	Responses:
+//		200: ArchiveResponse
+func (a *ArchiveRoute) Handler() router.RouterHandler {
+	return func(c *fiber.Ctx) (int, interface{}, error) {
+		channel := strings.ToLower(c.Query("channel", ""))
+		if channel == "" {
+			return http.StatusBadRequest, nil, fmt.Errorf("missing channel parameter")
+		}
+
+		to := time.Now()
+		if c.Query("to") != "" {
+			t, err := parseTime(c.Query("to"))
+			if err != nil {
+				return http.StatusBadRequest, nil, fmt.Errorf("invalid to parameter")
+			}
+
+			to = t
+		}
+
+		from := to.Add(-24 * time.Hour)
+		if c.Query("from") != "" {
+			t, err := parseTime(c.Query("from"))
+			if err != nil {
+				return http.StatusBadRequest, nil, fmt.Errorf("invalid from parameter")
+			}
+
+			from = t
+		}
+
+		if !from.Before(to) {
+			return http.StatusBadRequest, nil, fmt.Errorf("from has to be before to")
+		}
+
+		limit := int64(DEFAULT_LIMIT)
+		if c.Query("limit") != "" {
+			l, err := strconv.ParseInt(c.Query("limit"), 10, 64)
+			if err != nil || l <= 0 {
+				return http.StatusBadRequest, nil, fmt.Errorf("invalid limit parameter")
+			}
+
+			if l > MAX_LIMIT {
+				l = MAX_LIMIT
+			}
+
+			limit = l
+		}
+
+		twitch := mongo.TwitchChannel{TwitchName: channel}
+		if err := twitch.GetByName(c.Context(), a.Ctx.Inst().Mongo); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return http.StatusNotFound, nil, fmt.Errorf("channel is not tracked")
+			}
+
+			zap.S().Errorw("Failed to get channel", "channel", channel, "error", err)
+
+			return http.StatusInternalServerError, nil, router.ErrInternalServerError
+		}
+
+		messages, err := mongo.FindArchivedMessages(c.Context(), a.Ctx.Inst().Mongo, twitch.TwitchID, from, to, limit)
+		if err != nil {
+			zap.S().Errorw("Failed to get archived messages", "channel", channel, "error", err)
+
+			return http.StatusInternalServerError, nil, router.ErrInternalServerError
+		}
+
+		return http.StatusOK, ArchiveResponse{
+			Channel:  channel,
+			Messages: messages,
+		}, nil
+	}
+}
+
+// parseTime accepts RFC3339 or unix milliseconds
+func parseTime(value string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
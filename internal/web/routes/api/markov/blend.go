@@ -0,0 +1,193 @@
+package markov
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/JoachimFlottorp/magnolia/internal/chatdata"
+	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/internal/web/locals"
+	"github.com/JoachimFlottorp/magnolia/internal/web/router"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	MAX_BLEND_CHANNELS = 5
+	MAX_BLEND_WEIGHT   = 100
+)
+
+// swagger:parameters markovBlend
+type MarkovBlendParams struct {
+	// in: body
+	// required: true
+	Body MarkovBlendRequest
+}
+
+type MarkovBlendRequest struct {
+	// The channels to blend, 2 to 5
+	Channels []BlendChannel `json:"channels"`
+	// Generate a markov chain based on a custom seed
+	Seed string `json:"seed"`
+	// Where the seed goes, contains for anywhere or start to start the sentence with it. Defaults to contains
+	SeedMode string `json:"seed_mode"`
+	// How many words the next word is picked by, 1 to 2. Defaults to 1
+	StateSize *int `json:"state_size"`
+	// The least amount of words in the sentence, 1 to 30. Defaults to 10
+	MinWords *int `json:"min_words"`
+	// The least score of the sentence, 0 to 100. Defaults to 6
+	MinScore *int `json:"min_score"`
+	// How many sentences are tried before giving up, 1 to 10000
+	MaxTries *int `json:"max_tries"`
+}
+
+type BlendChannel struct {
+	Channel string `json:"channel"`
+	// How much the channel is used compared to the others, regardless of how much each channel has said.
+	// Up to 100, defaults to 1
+	Weight float64 `json:"weight"`
+}
+
+// swagger:model MarkovBlendResponse
+type MarkovBlendResponse struct {
+	// The generated markov chain
+	Markov string `json:"markov"`
+	// The channels which contributed to the markov chain, most words first
+	Sources []BlendSource `json:"sources"`
+}
+
+type BlendSource struct {
+	Channel string `json:"channel"`
+	// How many of the words could have come from the channel
+	Words int `json:"words"`
+}
+
+type BlendRoute struct {
+	Ctx    ctx.Context
+	markov *MarkovRoute
+}
+
+// newBlendRoute shares the generators of the markov route
+func (a *MarkovRoute) newBlendRoute(gCtx ctx.Context) router.Route {
+	return &BlendRoute{
+		Ctx:    gCtx,
+		markov: a,
+	}
+}
+
+func (a *BlendRoute) Configure() router.RouteConfig {
+	return router.RouteConfig{
+		URI:    "/blend",
+		Method: []string{http.MethodPost},
+	}
+}
+
+// swagger:route POST /api/markov/blend markov markovBlend
+//
+// Generate a markov chain from the chat of several channels at once
+//
+//	Responses:
+//		200: MarkovBlendResponse
+func (a *BlendRoute) Handler() router.RouterHandler {
+	return func(c *fiber.Ctx) (int, interface{}, error) {
+		u := c.Locals(locals.LocalRequestID).(uuid.UUID)
+
+		var body MarkovBlendRequest
+		if err := json.Unmarshal(c.Body(), &body); err != nil {
+			return http.StatusBadRequest, nil, fmt.Errorf("invalid body")
+		}
+
+		req, err := generateOptions{
+			Seed:      body.Seed,
+			SeedMode:  body.SeedMode,
+			StateSize: body.StateSize,
+			MinWords:  body.MinWords,
+			MinScore:  body.MinScore,
+			MaxTries:  body.MaxTries,
+		}.request()
+		if err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+
+		if req.Sources, err = blendSources(body.Channels); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+
+		for _, src := range req.Sources {
+			stored, err := a.Ctx.Inst().Redis.LLen(c.Context(), chatdata.Key(src.Channel))
+			if err != nil {
+				zap.S().Errorw("Failed to get channel data from redis", "channel", src.Channel, "error", err)
+
+				return http.StatusInternalServerError, nil, router.ErrInternalServerError
+			}
+
+			if stored == 0 {
+				return http.StatusNotFound, nil, fmt.Errorf("%s: %w", src.Channel, ErrNoData)
+			} else if stored < 100 {
+				return http.StatusInternalServerError, nil, fmt.Errorf("%s: %w", src.Channel, ErrNotEnoughData(int(stored)))
+			}
+		}
+
+		result, status, err := a.markov.generate(c.Context(), req, u)
+		if err != nil {
+			return status, nil, err
+		}
+
+		res := MarkovBlendResponse{
+			Markov:  result.Text,
+			Sources: []BlendSource{},
+		}
+
+		for channel, words := range result.Sources {
+			if words > 0 {
+				res.Sources = append(res.Sources, BlendSource{Channel: channel, Words: words})
+			}
+		}
+
+		sort.Slice(res.Sources, func(i, j int) bool {
+			if res.Sources[i].Words != res.Sources[j].Words {
+				return res.Sources[i].Words > res.Sources[j].Words
+			}
+
+			return res.Sources[i].Channel < res.Sources[j].Channel
+		})
+
+		return http.StatusOK, res, nil
+	}
+}
+
+// blendSources checks the channels of a blend, a weight left out is 1
+func blendSources(channels []BlendChannel) ([]Source, error) {
+	if len(channels) < 2 || len(channels) > MAX_BLEND_CHANNELS {
+		return nil, fmt.Errorf("blend 2 to %d channels", MAX_BLEND_CHANNELS)
+	}
+
+	seen := make(map[string]bool, len(channels))
+	sources := make([]Source, 0, len(channels))
+
+	for _, ch := range channels {
+		channel := strings.ToLower(ch.Channel)
+		if channel == "" {
+			return nil, fmt.Errorf("missing channel")
+		} else if seen[channel] {
+			return nil, fmt.Errorf("%s is blended more than once", channel)
+		}
+
+		seen[channel] = true
+
+		weight := ch.Weight
+		if weight == 0 {
+			weight = 1
+		} else if weight < 0 || weight > MAX_BLEND_WEIGHT {
+			return nil, fmt.Errorf("invalid weight of %s, has to be between 0 and %d", channel, MAX_BLEND_WEIGHT)
+		}
+
+		sources = append(sources, Source{Channel: channel, Weight: weight})
+	}
+
+	return sources, nil
+}
@@ -0,0 +1,90 @@
+package markov
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/internal/markov"
+)
+
+const (
+	GENERATOR_REMOTE = "remote"
+	GENERATOR_NATIVE = "native"
+
+	// MIN_WORDS is the least amount of words in a generated sentence
+	MIN_WORDS = 10
+	// MIN_SCORE is the least score of a generated sentence, which keeps it from repeating a single message
+	MIN_SCORE = 6
+	// STATE_SIZE is how many words the next word is picked by
+	STATE_SIZE = 1
+
+	// The bounds of the options a request can change
+	MAX_MIN_WORDS = 30
+	MAX_MIN_SCORE = 100
+	MAX_TRIES     = 10000
+)
+
+// Source is a channel a sentence is generated from
+type Source struct {
+	Channel string
+	// Weight is how much the channel is used compared to the other sources
+	Weight float64
+}
+
+// GenerateRequest is what a sentence is generated from
+type GenerateRequest struct {
+	Sources []Source
+	// Seed is a word the sentence has to contain, empty for any sentence
+	Seed     string
+	SeedMode markov.SeedMode
+
+	StateSize int
+	MinWords  int
+	MinScore  int
+	// MaxTries is up to the generator when 0
+	MaxTries int
+}
+
+// Result is a generated sentence
+type Result struct {
+	Text string
+	// Sources is how many of the words could have come from each channel
+	Sources map[string]int
+}
+
+// Generator generates sentences from the chat data of channels.
+//
+// Generate returns ErrNoData when the channel has no chat data, ErrUnableToGenerate
+// when no sentence fit the request and ErrTooLong when ctx is done first.
+type Generator interface {
+	Name() string
+	// Alive tells whether the generator can be asked right now
+	Alive() bool
+	Generate(ctx context.Context, req GenerateRequest) (Result, error)
+}
+
+// newGenerators returns the generator picked by the config, and the one to use while it is not alive
+func newGenerators(gCtx ctx.Context) (Generator, Generator, error) {
+	native := newNativeGenerator(gCtx)
+
+	switch gCtx.Config().Markov.Generator {
+	case "", GENERATOR_REMOTE:
+		{
+			remote, err := newRemoteGenerator(gCtx)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return remote, native, nil
+		}
+	case GENERATOR_NATIVE:
+		{
+			return native, nil, nil
+		}
+	default:
+		{
+			return nil, nil, fmt.Errorf("unknown markov generator %q", gCtx.Config().Markov.Generator)
+		}
+	}
+}
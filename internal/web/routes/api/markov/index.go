@@ -4,11 +4,9 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
-	"github.com/JoachimFlottorp/GoCommon/assert"
-	"github.com/JoachimFlottorp/GoCommon/cron"
+	"github.com/JoachimFlottorp/magnolia/internal/chatdata"
 	"github.com/JoachimFlottorp/magnolia/internal/ctx"
 	"github.com/JoachimFlottorp/magnolia/internal/rabbitmq"
 	"github.com/JoachimFlottorp/magnolia/internal/web/locals"
@@ -19,10 +17,13 @@ import (
 	"github.com/rabbitmq/amqp091-go"
 	"google.golang.org/protobuf/proto"
 
-	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 )
 
+const (
+	MARKOV_TIMEOUT = 10 * time.Second
+)
+
 var (
 	ErrNoData           = fmt.Errorf("no data")
 	ErrTooLong          = fmt.Errorf("took to long to generate markov chain")
@@ -53,13 +54,37 @@ type MarkovGetParams struct {
 	// required: false
 	// type: string
 	Seed string `json:"seed"`
+	// in: query
+	// description: Where the seed goes, contains for anywhere or start to start the sentence with it. Defaults to contains
+	// required: false
+	// type: string
+	SeedMode string `json:"seed_mode"`
+	// in: query
+	// description: How many words the next word is picked by, 1 to 2. Defaults to 1
+	// required: false
+	// type: integer
+	StateSize int `json:"state_size"`
+	// in: query
+	// description: The least amount of words in the sentence, 1 to 30. Defaults to 10
+	// required: false
+	// type: integer
+	MinWords int `json:"min_words"`
+	// in: query
+	// description: The least score of the sentence, how many other words could have been picked while generating it, 0 to 100. Defaults to 6
+	// required: false
+	// type: integer
+	MinScore int `json:"min_score"`
+	// in: query
+	// description: How many sentences are tried before giving up, 1 to 10000
+	// required: false
+	// type: integer
+	MaxTries int `json:"max_tries"`
 }
 
 type MarkovRoute struct {
-	Ctx        ctx.Context
-	markovReqs map[string]chan *pb.MarkovResponse
-	isAlive    bool
-	cronMan    *cron.Manager
+	Ctx      ctx.Context
+	primary  Generator
+	fallback Generator
 }
 
 func NewGetRoute(gCtx ctx.Context) router.Route {
@@ -71,27 +96,16 @@ func NewGetRoute(gCtx ctx.Context) router.Route {
 		zap.S().Fatalw("Failed to create rabbitmq queue", "name", rabbitmq.QueueJoinRequest, "error", err)
 	}
 
-	a := &MarkovRoute{
-		Ctx:        gCtx,
-		markovReqs: make(map[string]chan *pb.MarkovResponse),
+	primary, fallback, err := newGenerators(gCtx)
+	if err != nil {
+		zap.S().Fatalw("Failed to create markov generator", "error", err)
 	}
 
-	a.cronMan = cron.NewManager(gCtx, false)
-
-	go a.handleMarkovRequests()
-
-	assert.Error(a.cronMan.Add(cron.CronOptions{
-		Name:   "ping_markov_generator",
-		Spec:   "*/5 * * * *",
-		RunNow: true,
-		Cmd: func() {
-			a.pingMarkovGenerator()
-		},
-	}), "Failed to add cron job")
-
-	a.cronMan.Start()
-
-	return a
+	return &MarkovRoute{
+		Ctx:      gCtx,
+		primary:  primary,
+		fallback: fallback,
+	}
 }
 
 func (a *MarkovRoute) Configure() router.RouteConfig {
@@ -100,6 +114,7 @@ func (a *MarkovRoute) Configure() router.RouteConfig {
 		Method: []string{http.MethodGet},
 		Children: []router.RouteInitializerFunc{
 			NewListRoute,
+			a.newBlendRoute,
 		},
 	}
 }
@@ -113,23 +128,34 @@ func (a *MarkovRoute) Configure() router.RouteConfig {
 func (a *MarkovRoute) Handler() router.RouterHandler {
 	return func(c *fiber.Ctx) (int, interface{}, error) {
 		channel := c.Query("channel", "")
-		seed := c.Query("seed", "")
 
-		key := fmt.Sprintf("twitch:%s:chat-data", channel)
+		key := chatdata.Key(channel)
 		u := c.Locals(locals.LocalRequestID).(uuid.UUID)
 
 		if channel == "" {
 			return http.StatusBadRequest, nil, fmt.Errorf("missing channel parameter")
 		}
 
-		storedData, err := a.Ctx.Inst().Redis.GetAllList(c.Context(), key)
+		opts, err := queryOptions(c)
 		if err != nil {
-			if err != redis.Nil {
-				zap.S().Errorf("Failed to get channel data from redis: %s", err)
+			return http.StatusBadRequest, nil, err
+		}
 
-				return http.StatusInternalServerError, nil, router.ErrInternalServerError
-			}
+		req, err := opts.request()
+		if err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+
+		req.Sources = []Source{{Channel: channel, Weight: 1}}
 
+		stored, err := a.Ctx.Inst().Redis.LLen(c.Context(), key)
+		if err != nil {
+			zap.S().Errorf("Failed to get channel data from redis: %s", err)
+
+			return http.StatusInternalServerError, nil, router.ErrInternalServerError
+		}
+
+		if stored == 0 {
 			req := pb.SubChannelReq{
 				Channel: channel,
 			}
@@ -162,169 +188,64 @@ func (a *MarkovRoute) Handler() router.RouterHandler {
 			}
 
 			return http.StatusNotFound, nil, ErrNoData
-		} else if l := len(storedData); l < 100 {
+		} else if stored < 100 {
 
-			return http.StatusInternalServerError, nil, ErrNotEnoughData(l)
-		} else if !a.isAlive {
-			return http.StatusInternalServerError, nil, ErrMarkovNotAlive
+			return http.StatusInternalServerError, nil, ErrNotEnoughData(int(stored))
 		}
 
-		markovChan, err := a.genMarkov(c.Context(), u, storedData, seed)
-
+		result, status, err := a.generate(c.Context(), req, u)
 		if err != nil {
-			zap.S().Errorw("Failed to generate markov chain", "error", err)
-
-			return http.StatusInternalServerError, nil, router.ErrInternalServerError
-		}
-
-		result, ok := <-markovChan
-
-		if !ok {
-			zap.S().Errorw("Took to long to generate markov chain", "channel", channel)
-
-			return http.StatusInternalServerError, nil, ErrTooLong
+			return status, nil, err
 		}
 
-		if result.Error != nil {
-
-			if strings.HasPrefix(*result.Error, "Failed to build a sentence after") {
-				return http.StatusNotFound, nil, ErrUnableToGenerate
-			} else {
-				return http.StatusInternalServerError, nil, router.ErrInternalServerError
-			}
-		}
-
-		return http.StatusOK, MarkovResponse{Markov: result.Result}, nil
+		return http.StatusOK, MarkovResponse{Markov: result.Text}, nil
 	}
 }
 
-func (a *MarkovRoute) handleMarkovRequests() {
-	msg, err := a.Ctx.Inst().RMQ.Consume(a.Ctx, rabbitmq.ConsumeSettings{
-		Queue: rabbitmq.QueueMarkovGenenerator,
-	})
-
-	if err != nil {
-		zap.S().Errorw("Failed to consume from RabbitMQ", "error", err)
-		return
+// generate asks the generator for a sentence and returns the status code for its error
+func (a *MarkovRoute) generate(ctx context.Context, req GenerateRequest, u uuid.UUID) (Result, int, error) {
+	gen := a.generator()
+	if gen == nil {
+		return Result{}, http.StatusInternalServerError, ErrMarkovNotAlive
 	}
 
-	for {
-		select {
-		case m := <-msg:
-			{
-				var res pb.MarkovResponse
-				err := proto.Unmarshal(m.Body, &res)
-				if res.Error != nil {
-					zap.S().Errorw("Failed to generate markov chain", "error", res.Error)
-				}
-				if err != nil {
-					zap.S().Errorw("Failed to unmarshal protobuf message", "error", err)
-					continue
-				}
-
-				zap.S().Debugf("Generated markov chain: %s", res.Result)
-
-				if ch, ok := a.markovReqs[m.CorrelationId]; ok {
-					ch <- &res
-					close(ch)
-					delete(a.markovReqs, m.CorrelationId)
-				} else {
-					a.markovReqs[m.CorrelationId] = make(chan *pb.MarkovResponse)
-					a.markovReqs[m.CorrelationId] <- &res
-				}
-			}
-		case <-a.Ctx.Done():
-			return
-		}
-	}
-}
-
-func (a *MarkovRoute) genMarkov(ctx context.Context, corrId uuid.UUID, data []string, seed string) (chan *pb.MarkovResponse, error) {
-	p := pb.MarkovRequest{
-		Messages: data,
-	}
-
-	if seed != "" {
-		p.Seed = &seed
-	}
-
-	reqByte, err := proto.Marshal(&p)
-	if err != nil {
-		return nil, err
-	}
+	result, err := gen.Generate(ctx, req)
 
-	_ = a.Ctx.Inst().RMQ.Publish(ctx, rabbitmq.PublishSettings{
-		RoutingKey: rabbitmq.QueueMarkovGenenerator,
-		Msg: amqp091.Publishing{
-			CorrelationId: corrId.String(),
-			Body:          reqByte,
-		},
-	})
-
-	markovChan := make(chan *pb.MarkovResponse)
-
-	go func() {
-		if a.markovReqs[corrId.String()] == nil {
-			a.markovReqs[corrId.String()] = make(chan *pb.MarkovResponse)
+	switch {
+	case err == nil:
+		{
+			return result, http.StatusOK, nil
 		}
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case res, ok := <-a.markovReqs[corrId.String()]:
-				{
-					if !ok {
-						return
-					}
-					markovChan <- res
-					close(markovChan)
-					delete(a.markovReqs, corrId.String())
-					return
-				}
-			case <-time.After(10 * time.Second):
-				{
-					close(markovChan)
-					delete(a.markovReqs, corrId.String())
-					return
-				}
-			}
+	case err == ErrNoData, err == ErrUnableToGenerate:
+		{
+			return Result{}, http.StatusNotFound, err
 		}
-	}()
-
-	return markovChan, nil
-}
-
-func (a *MarkovRoute) pingMarkovGenerator() {
-	zap.S().Infow("Pinging markov generator")
+	case err == ErrTooLong:
+		{
+			zap.S().Errorw("Took to long to generate markov chain", "sources", req.Sources, "generator", gen.Name(), "request_id", u)
 
-	url := fmt.Sprintf("%s/health", a.Ctx.Config().Markov.HealthAddress)
-	req, err := http.NewRequestWithContext(a.Ctx, http.MethodGet, url, nil)
-	if err != nil {
-		zap.S().Errorw("Failed to create health check request", "error", err)
-
-		a.isAlive = false
+			return Result{}, http.StatusInternalServerError, ErrTooLong
+		}
+	default:
+		{
+			zap.S().Errorw("Failed to generate markov chain", "generator", gen.Name(), "error", err, "request_id", u)
 
-		return
+			return Result{}, http.StatusInternalServerError, router.ErrInternalServerError
+		}
 	}
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		zap.S().Errorw("Failed to execute health check request", "error", err)
-
-		a.isAlive = false
-
-		return
+// generator returns the configured generator, or the fallback while it is not alive
+func (a *MarkovRoute) generator() Generator {
+	if a.primary.Alive() {
+		return a.primary
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		zap.S().Errorw("Markov generator is not healthy", "status", resp.StatusCode)
-
-		a.isAlive = false
+	if a.fallback != nil && a.fallback.Alive() {
+		zap.S().Debugw("Falling back to another markov generator", "generator", a.primary.Name(), "fallback", a.fallback.Name())
 
-		return
+		return a.fallback
 	}
 
-	a.isAlive = true
-	zap.S().Infow("Markov generator is healthy")
+	return nil
 }
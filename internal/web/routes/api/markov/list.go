@@ -2,9 +2,11 @@ package markov
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/JoachimFlottorp/magnolia/internal/ctx"
 	"github.com/JoachimFlottorp/magnolia/internal/mongo"
+	"github.com/JoachimFlottorp/magnolia/internal/shard"
 	"github.com/JoachimFlottorp/magnolia/internal/web/router"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,8 +19,12 @@ type MarkovListResponse struct {
 }
 
 type basicChannel struct {
-	Username string `json:"username"`
-	UserID   string `json:"user_id"`
+	Username  string     `json:"username"`
+	UserID    string     `json:"user_id"`
+	JoinedAt  *time.Time `json:"joined_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	// Shard is the twitch-reader owning the channel
+	Shard string `json:"shard,omitempty"`
 }
 
 type ListRoute struct {
@@ -51,6 +57,18 @@ func (a *ListRoute) Handler() router.RouterHandler {
 			return http.StatusInternalServerError, nil, router.ErrInternalServerError
 		}
 
+		live, err := shard.Live(c.Context(), a.Ctx.Inst().Redis)
+		if err != nil {
+			zap.S().Errorw("failed to get shards", "error", err)
+
+			return http.StatusInternalServerError, nil, router.ErrInternalServerError
+		}
+
+		shards := make([]string, len(live))
+		for i, hb := range live {
+			shards[i] = hb.ID
+		}
+
 		var resp MarkovListResponse
 		for cur.Next(c.Context()) {
 			var channel mongo.TwitchChannel
@@ -61,8 +79,11 @@ func (a *ListRoute) Handler() router.RouterHandler {
 			}
 
 			resp.Channels = append(resp.Channels, basicChannel{
-				Username: channel.TwitchName,
-				UserID:   channel.TwitchID,
+				Username:  channel.TwitchName,
+				UserID:    channel.TwitchID,
+				JoinedAt:  channel.JoinedAt,
+				LastError: channel.LastError,
+				Shard:     shard.Owner(channel.TwitchName, shards),
 			})
 		}
 
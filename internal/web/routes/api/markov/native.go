@@ -0,0 +1,118 @@
+package markov
+
+import (
+	"context"
+	"errors"
+
+	"github.com/JoachimFlottorp/magnolia/internal/chatdata"
+	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/internal/markov"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// NATIVE_MAX_TRIES is how many sentences are walked before giving up, MARKOV_TIMEOUT still applies
+	NATIVE_MAX_TRIES = 1000
+)
+
+// nativeGenerator walks the markov models the twitch-reader keeps in redis.
+//
+// Channels whose model has not been built yet have one counted in memory from their chat data.
+type nativeGenerator struct {
+	gCtx ctx.Context
+}
+
+func newNativeGenerator(gCtx ctx.Context) *nativeGenerator {
+	return &nativeGenerator{gCtx}
+}
+
+func (g *nativeGenerator) Name() string {
+	return GENERATOR_NATIVE
+}
+
+func (g *nativeGenerator) Alive() bool {
+	return true
+}
+
+func (g *nativeGenerator) Generate(ctx context.Context, req GenerateRequest) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, MARKOV_TIMEOUT)
+	defer cancel()
+
+	sources := make([]markov.Source, 0, len(req.Sources))
+	for _, src := range req.Sources {
+		store, err := g.store(ctx, src.Channel)
+		if err != nil {
+			return Result{}, err
+		}
+
+		sources = append(sources, markov.Source{
+			Channel: src.Channel,
+			Store:   store,
+			Weight:  src.Weight,
+		})
+	}
+
+	maxTries := req.MaxTries
+	if maxTries == 0 {
+		maxTries = NATIVE_MAX_TRIES
+	}
+
+	sentence, err := markov.Blend(ctx, sources, markov.Options{
+		StateSize: req.StateSize,
+		MinWords:  req.MinWords,
+		MinScore:  int64(req.MinScore),
+		MaxTries:  maxTries,
+		Seed:      req.Seed,
+		SeedMode:  req.SeedMode,
+	})
+
+	switch {
+	case err == nil:
+		{
+			return Result{Text: sentence.Text, Sources: sentence.Sources}, nil
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		{
+			return Result{}, ErrTooLong
+		}
+	case err == markov.ErrNoModel:
+		{
+			return Result{}, ErrNoData
+		}
+	case err == markov.ErrSeedNotFound, err == markov.ErrUnableToGenerate:
+		{
+			return Result{}, ErrUnableToGenerate
+		}
+	default:
+		{
+			return Result{}, err
+		}
+	}
+}
+
+func (g *nativeGenerator) store(ctx context.Context, channel string) (markov.Store, error) {
+	rds := g.gCtx.Inst().Redis
+
+	built, err := markov.Built(ctx, rds, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	if built {
+		return rds, nil
+	}
+
+	stored, err := rds.GetAllList(ctx, chatdata.Key(channel))
+	if err == redis.Nil {
+		return nil, ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+
+	store := markov.NewMemoryStore()
+	if err := markov.Add(ctx, store, channel, chatdata.Texts(stored)...); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
@@ -0,0 +1,99 @@
+package markov
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/JoachimFlottorp/magnolia/internal/markov"
+	"github.com/gofiber/fiber/v2"
+)
+
+// generateOptions are what a request can change about the sentence, anything left out is the default
+type generateOptions struct {
+	Seed      string `json:"seed"`
+	SeedMode  string `json:"seed_mode"`
+	StateSize *int   `json:"state_size"`
+	MinWords  *int   `json:"min_words"`
+	MinScore  *int   `json:"min_score"`
+	MaxTries  *int   `json:"max_tries"`
+}
+
+// queryOptions reads the options from the query
+func queryOptions(c *fiber.Ctx) (generateOptions, error) {
+	opts := generateOptions{
+		Seed:     c.Query("seed", ""),
+		SeedMode: c.Query("seed_mode", ""),
+	}
+
+	for name, v := range map[string]**int{
+		"state_size": &opts.StateSize,
+		"min_words":  &opts.MinWords,
+		"min_score":  &opts.MinScore,
+		"max_tries":  &opts.MaxTries,
+	} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s parameter", name)
+		}
+
+		*v = &i
+	}
+
+	return opts, nil
+}
+
+// request checks the options are within bounds and fills in the defaults, the sources are left to the caller
+func (o generateOptions) request() (GenerateRequest, error) {
+	req := GenerateRequest{
+		Seed:     o.Seed,
+		SeedMode: markov.SeedMode(o.SeedMode),
+	}
+
+	if req.SeedMode == "" {
+		req.SeedMode = markov.SEED_CONTAINS
+	}
+
+	if req.SeedMode != markov.SEED_CONTAINS && req.SeedMode != markov.SEED_START {
+		return req, fmt.Errorf("invalid seed_mode parameter, has to be contains or start")
+	} else if req.SeedMode == markov.SEED_START && req.Seed == "" {
+		return req, fmt.Errorf("seed_mode start needs a seed")
+	}
+
+	var err error
+
+	if req.StateSize, err = bounded("state_size", o.StateSize, STATE_SIZE, 1, markov.MAX_STATE_SIZE); err != nil {
+		return req, err
+	}
+
+	if req.MinWords, err = bounded("min_words", o.MinWords, MIN_WORDS, 1, MAX_MIN_WORDS); err != nil {
+		return req, err
+	}
+
+	if req.MinScore, err = bounded("min_score", o.MinScore, MIN_SCORE, 0, MAX_MIN_SCORE); err != nil {
+		return req, err
+	}
+
+	if req.MaxTries, err = bounded("max_tries", o.MaxTries, 0, 1, MAX_TRIES); err != nil {
+		return req, err
+	}
+
+	return req, nil
+}
+
+// bounded returns def when v is nil, otherwise v has to be between min and max
+func bounded(name string, v *int, def, min, max int) (int, error) {
+	if v == nil {
+		return def, nil
+	}
+
+	if *v < min || *v > max {
+		return 0, fmt.Errorf("invalid %s parameter, has to be between %d and %d", name, min, max)
+	}
+
+	return *v, nil
+}
@@ -0,0 +1,318 @@
+package markov
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/JoachimFlottorp/GoCommon/cron"
+	"github.com/JoachimFlottorp/magnolia/internal/chatdata"
+	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/internal/markov"
+	"github.com/JoachimFlottorp/magnolia/internal/rabbitmq"
+	pb "github.com/JoachimFlottorp/magnolia/protobuf"
+	"github.com/go-redis/redis/v8"
+	"github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// remoteGenerator sends the chat data to the markov-generator over rabbitmq
+type remoteGenerator struct {
+	gCtx    ctx.Context
+	isAlive atomic.Bool
+	cronMan *cron.Manager
+
+	// rpc is nil while the client is being created again after it closed
+	rpcMtx sync.Mutex
+	rpc    *rabbitmq.RPCClient
+}
+
+func newRemoteGenerator(gCtx ctx.Context) (*remoteGenerator, error) {
+	rpc, err := gCtx.Inst().RMQ.NewRPCClient(gCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &remoteGenerator{
+		gCtx: gCtx,
+		rpc:  rpc,
+	}
+
+	go g.keepClient(rpc)
+
+	g.cronMan = cron.NewManager(gCtx, false)
+
+	err = g.cronMan.Add(cron.CronOptions{
+		Name:   "ping_markov_generator",
+		Spec:   "*/5 * * * *",
+		RunNow: true,
+		Cmd: func() {
+			g.pingMarkovGenerator()
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g.cronMan.Start()
+
+	return g, nil
+}
+
+func (g *remoteGenerator) Name() string {
+	return GENERATOR_REMOTE
+}
+
+// Alive is false while the generator fails its health check or there is no client to reach it with
+func (g *remoteGenerator) Alive() bool {
+	return g.isAlive.Load() && g.client() != nil
+}
+
+func (g *remoteGenerator) client() *rabbitmq.RPCClient {
+	g.rpcMtx.Lock()
+	defer g.rpcMtx.Unlock()
+
+	return g.rpc
+}
+
+// keepClient creates the RPC client again whenever it closes, like when RabbitMQ restarts
+func (g *remoteGenerator) keepClient(rpc *rabbitmq.RPCClient) {
+	for {
+		select {
+		case <-g.gCtx.Done():
+			return
+		case <-rpc.Done():
+		}
+
+		zap.S().Warn("Markov generator RPC client closed, creating a new one")
+
+		g.rpcMtx.Lock()
+		g.rpc = nil
+		g.rpcMtx.Unlock()
+
+		wait := rabbitmq.REDIAL_MIN
+
+		for {
+			select {
+			case <-g.gCtx.Done():
+				return
+			case <-time.After(wait):
+			}
+
+			var err error
+			if rpc, err = g.gCtx.Inst().RMQ.NewRPCClient(g.gCtx); err == nil {
+				break
+			}
+
+			zap.S().Errorw("Failed to create markov generator RPC client", "error", err, "in", wait)
+
+			if wait *= 2; wait > rabbitmq.REDIAL_MAX {
+				wait = rabbitmq.REDIAL_MAX
+			}
+		}
+
+		g.rpcMtx.Lock()
+		g.rpc = rpc
+		g.rpcMtx.Unlock()
+	}
+}
+
+func (g *remoteGenerator) Generate(ctx context.Context, req GenerateRequest) (Result, error) {
+	corpora := make([][]string, len(req.Sources))
+	for i, src := range req.Sources {
+		storedData, err := g.gCtx.Inst().Redis.GetAllList(ctx, chatdata.Key(src.Channel))
+		if err == redis.Nil {
+			return Result{}, ErrNoData
+		} else if err != nil {
+			return Result{}, err
+		}
+
+		corpora[i] = chatdata.Texts(storedData)
+	}
+
+	corpora = blendCorpora(corpora, req.Sources)
+
+	var data []string
+	for _, corpus := range corpora {
+		data = append(data, corpus...)
+	}
+
+	result, err := g.genMarkov(ctx, data, req)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Result{}, ErrTooLong
+	} else if err != nil {
+		return Result{}, err
+	}
+
+	if result.Error != nil {
+		if strings.HasPrefix(*result.Error, "Failed to build a sentence after") {
+			return Result{}, ErrUnableToGenerate
+		}
+
+		return Result{}, fmt.Errorf("markov generator: %s", *result.Error)
+	}
+
+	return Result{
+		Text:    result.Result,
+		Sources: attribute(result.Result, corpora, req.Sources),
+	}, nil
+}
+
+// blendCorpora takes the newest messages of every source in proportion to its weight,
+// as many as the source with the fewest messages for its weight allows
+func blendCorpora(corpora [][]string, sources []Source) [][]string {
+	if len(corpora) < 2 {
+		return corpora
+	}
+
+	var total float64
+	for _, src := range sources {
+		total += src.Weight
+	}
+
+	size := math.Inf(1)
+	for i, src := range sources {
+		if src.Weight > 0 {
+			size = math.Min(size, float64(len(corpora[i]))*total/src.Weight)
+		}
+	}
+
+	blended := make([][]string, len(corpora))
+	for i, src := range sources {
+		n := int(size * src.Weight / total)
+		if n > len(corpora[i]) {
+			n = len(corpora[i])
+		}
+
+		// Chat data is pushed newest first
+		blended[i] = corpora[i][:n]
+	}
+
+	return blended
+}
+
+// attribute counts the words of the sentence each source could have been picked from,
+// a word could have been picked from a source which said it after the word in front of it
+func attribute(text string, corpora [][]string, sources []Source) map[string]int {
+	words := markov.Words(text)
+	counts := make(map[string]int)
+
+	for i, corpus := range corpora {
+		said := make(map[string]bool)
+		for _, msg := range corpus {
+			prev := markov.START
+			for _, w := range markov.Words(msg) {
+				said[prev+" "+w] = true
+				prev = w
+			}
+		}
+
+		prev := markov.START
+		for _, w := range words {
+			if said[prev+" "+w] {
+				counts[sources[i].Channel]++
+			}
+
+			prev = w
+		}
+	}
+
+	return counts
+}
+
+// genMarkov asks the markov-generator for a markov chain, giving up after MARKOV_TIMEOUT
+func (g *remoteGenerator) genMarkov(ctx context.Context, data []string, req GenerateRequest) (*pb.MarkovResponse, error) {
+	p := pb.MarkovRequest{
+		Messages:  data,
+		StateSize: proto.Int32(int32(req.StateSize)),
+		MinWords:  proto.Int32(int32(req.MinWords)),
+		MinScore:  proto.Int32(int32(req.MinScore)),
+	}
+
+	if req.Seed != "" {
+		p.Seed = &req.Seed
+	}
+
+	if req.SeedMode == markov.SEED_START {
+		p.SeedMode = pb.SeedMode_SEED_MODE_START.Enum()
+	}
+
+	if req.MaxTries > 0 {
+		p.MaxTries = proto.Int32(int32(req.MaxTries))
+	}
+
+	reqByte, err := proto.Marshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, MARKOV_TIMEOUT)
+	defer cancel()
+
+	rpc := g.client()
+	if rpc == nil {
+		return nil, rabbitmq.ErrRPCClosed
+	}
+
+	reply, err := rpc.Call(ctx, rabbitmq.QueueMarkovGenenerator, amqp091.Publishing{
+		Body:        reqByte,
+		ContentType: "application/protobuf; proto.MarkovRequest",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res pb.MarkovResponse
+	if err := proto.Unmarshal(reply.Body, &res); err != nil {
+		return nil, err
+	}
+
+	if res.Error != nil {
+		zap.S().Errorw("Failed to generate markov chain", "error", *res.Error)
+	}
+
+	zap.S().Debugf("Generated markov chain: %s", res.Result)
+
+	return &res, nil
+}
+
+func (g *remoteGenerator) pingMarkovGenerator() {
+	zap.S().Infow("Pinging markov generator")
+
+	url := fmt.Sprintf("%s/health", g.gCtx.Config().Markov.HealthAddress)
+	req, err := http.NewRequestWithContext(g.gCtx, http.MethodGet, url, nil)
+	if err != nil {
+		zap.S().Errorw("Failed to create health check request", "error", err)
+
+		g.isAlive.Store(false)
+
+		return
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		zap.S().Errorw("Failed to execute health check request", "error", err)
+
+		g.isAlive.Store(false)
+
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		zap.S().Errorw("Markov generator is not healthy", "status", resp.StatusCode)
+
+		g.isAlive.Store(false)
+
+		return
+	}
+
+	g.isAlive.Store(true)
+	zap.S().Infow("Markov generator is healthy")
+}
@@ -0,0 +1,107 @@
+package shards
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/internal/mongo"
+	"github.com/JoachimFlottorp/magnolia/internal/shard"
+	"github.com/JoachimFlottorp/magnolia/internal/web/router"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+// swagger:model ShardsResponse
+type ShardsResponse struct {
+	// The twitch-readers which are running
+	// in: body
+	Shards []shardInfo `json:"shards"`
+}
+
+type shardInfo struct {
+	ID        string    `json:"id"`
+	StartedAt time.Time `json:"started_at"`
+	SeenAt    time.Time `json:"seen_at"`
+	// Joined is how many channels the shard is in right now
+	Joined int `json:"joined"`
+	// Channels are the channels the shard owns
+	Channels []string `json:"channels"`
+}
+
+type ShardsRoute struct {
+	Ctx ctx.Context
+}
+
+func NewGetRoute(gCtx ctx.Context) router.Route {
+	return &ShardsRoute{gCtx}
+}
+
+func (a *ShardsRoute) Configure() router.RouteConfig {
+	return router.RouteConfig{
+		URI:    "/shards",
+		Method: []string{http.MethodGet},
+	}
+}
+
+// swagger:route GET /api/shards shards
+//
+// Get the running twitch-readers and which channels each of them owns.
+//
+//	Responses:
+//		200: ShardsResponse
+func (a *ShardsRoute) Handler() router.RouterHandler {
+	return func(c *fiber.Ctx) (int, interface{}, error) {
+		live, err := shard.Live(c.Context(), a.Ctx.Inst().Redis)
+		if err != nil {
+			zap.S().Errorw("Failed to get shards", "error", err)
+
+			return http.StatusInternalServerError, nil, router.ErrInternalServerError
+		}
+
+		cur, err := a.Ctx.Inst().Mongo.Collection(mongo.CollectionTwitch).Find(c.Context(), bson.D{})
+		if err != nil {
+			zap.S().Errorw("Failed to find channels", "error", err)
+
+			return http.StatusInternalServerError, nil, router.ErrInternalServerError
+		}
+
+		channels := []mongo.TwitchChannel{}
+		if err := cur.All(c.Context(), &channels); err != nil {
+			zap.S().Errorw("Failed to decode channels", "error", err)
+
+			return http.StatusInternalServerError, nil, router.ErrInternalServerError
+		}
+
+		ids := make([]string, len(live))
+		resp := ShardsResponse{
+			Shards: make([]shardInfo, len(live)),
+		}
+		index := make(map[string]int, len(live))
+
+		for i, hb := range live {
+			ids[i] = hb.ID
+			index[hb.ID] = i
+			resp.Shards[i] = shardInfo{
+				ID:        hb.ID,
+				StartedAt: hb.StartedAt,
+				SeenAt:    hb.SeenAt,
+				Joined:    hb.Channels,
+				Channels:  []string{},
+			}
+		}
+
+		for _, channel := range channels {
+			owner := shard.Owner(channel.TwitchName, ids)
+			if owner == "" {
+				continue
+			}
+
+			info := &resp.Shards[index[owner]]
+			info.Channels = append(info.Channels, channel.TwitchName)
+		}
+
+		return http.StatusOK, resp, nil
+	}
+}
@@ -28,16 +28,22 @@ const configContent = Deno.readTextFileSync(args.config);
 
 	await rmqChannel.declareQueue({ queue, durable: true });
 
-	rmqChannel.consume({ queue }, async ({ deliveryTag }, { correlationId }, rawData) => {
+	rmqChannel.consume({ queue }, async ({ deliveryTag }, { correlationId, replyTo }, rawData) => {
+		rmqChannel.ack({ deliveryTag, multiple: false });
+
+		// Replies go to the exclusive queue of the caller, there is nobody to answer without one
+		if (!replyTo) {
+			console.warn('Ignoring markov request without a reply queue', { correlationId });
+			return;
+		}
+
 		const data = await fromProto(rawData);
 		console.log({ correlationId });
 
-		rmqChannel.ack({ deliveryTag, multiple: false });
-
 		let markov = '';
 		let error: string | undefined = undefined;
 		try {
-			markov = await generateMarkov(data.messages, data.seed ?? '');
+			markov = await generateMarkov(data);
 		} catch (e) {
 			console.error('Error generating markov', e);
 
@@ -47,7 +53,7 @@ const configContent = Deno.readTextFileSync(args.config);
 		console.log({ markov, error });
 
 		rmqChannel.publish(
-			{ routingKey: queue },
+			{ routingKey: replyTo },
 			{ correlationId, contentType: 'application/protobuf' },
 			await toProto({ result: markov, error }),
 		);
@@ -72,21 +78,41 @@ const toProto = async (data: MarkovResponse): Promise<Uint8Array> => {
 	return serialize(data);
 };
 
-const generateMarkov = (data: string[], seed: string): Promise<string> => {
+// Used for the options a request leaves out
+const defaults = {
+	stateSize: 1,
+	minWords: 10,
+	maxTries: 10000,
+	minScore: 6,
+};
+
+const generateMarkov = (req: MarkovRequest): Promise<string> => {
 	// Type 'string' is not assignable to type 'Promise<string>'.deno-ts(2322)
-	if (!data.length) return '';
+	if (!req.messages.length) return '';
+
+	const m = new Markov.default({ stateSize: req.stateSize ?? defaults.stateSize });
 
-	const m = new Markov.default({ stateSize: 1 });
+	m.addData(req.messages);
 
-	m.addData(data);
+	const seed = req.seed ?? '';
+	const minWords = req.minWords ?? defaults.minWords;
+	const minScore = req.minScore ?? defaults.minScore;
+	const startsWithSeed = req.seedMode === 'SEED_MODE_START';
 
 	const options: MarkovGenerateOptions = {
-		maxTries: 10000,
+		maxTries: req.maxTries ?? defaults.maxTries,
 		prng: Math.random,
-		filter: (r) =>
-			r.score > 5 &&
-			r.refs.filter((x) => x.string.includes(seed)).length > 0 &&
-			r.string.split(' ').length >= 10,
+		filter: (r) => {
+			const words = r.string.split(' ');
+
+			return (
+				r.score >= minScore &&
+				words.length >= minWords &&
+				(startsWithSeed
+					? words[0] === seed
+					: r.refs.filter((x) => x.string.includes(seed)).length > 0)
+			);
+		},
 	};
 
 	// Type 'string' is not assignable to type 'Promise<string>'.deno-ts(2322)
@@ -0,0 +1,44 @@
+package irc
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff describes how long a connection waits between reconnect attempts.
+type Backoff struct {
+	// Min is the delay before the first attempt
+	Min time.Duration
+	// Max caps the delay between attempts
+	Max time.Duration
+	// Factor is what the delay is multiplied with after every failed attempt
+	Factor float64
+	// Jitter is the fraction (0-1) of the delay that is randomized,
+	// so that connections dropped at the same time do not reconnect in lockstep.
+	Jitter float64
+	// MaxRetries is the amount of attempts before giving up, 0 means forever
+	MaxRetries int
+}
+
+var DefaultBackoff = Backoff{
+	Min:        1 * time.Second,
+	Max:        2 * time.Minute,
+	Factor:     2,
+	Jitter:     0.2,
+	MaxRetries: 10,
+}
+
+// Duration returns the delay before the given attempt, starting at 0.
+func (b Backoff) Duration(attempt int) time.Duration {
+	d := float64(b.Min) * math.Pow(b.Factor, float64(attempt))
+	if d > float64(b.Max) || math.IsInf(d, 0) || math.IsNaN(d) {
+		d = float64(b.Max)
+	}
+
+	if b.Jitter > 0 {
+		d -= d * b.Jitter * rand.Float64()
+	}
+
+	return time.Duration(d)
+}
@@ -0,0 +1,49 @@
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDuration(t *testing.T) {
+	b := Backoff{
+		Min:    1 * time.Second,
+		Max:    10 * time.Second,
+		Factor: 2,
+	}
+
+	testCases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 1 * time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{1000, 10 * time.Second},
+	}
+
+	for _, testCase := range testCases {
+		if got := b.Duration(testCase.attempt); got != testCase.want {
+			t.Errorf("attempt %d: got %v, want %v", testCase.attempt, got, testCase.want)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := Backoff{
+		Min:    1 * time.Second,
+		Max:    1 * time.Minute,
+		Factor: 2,
+		Jitter: 0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		got := b.Duration(2)
+
+		if got > 4*time.Second || got < 2*time.Second {
+			t.Errorf("got %v, want between 2s and 4s", got)
+		}
+	}
+}
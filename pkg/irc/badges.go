@@ -0,0 +1,61 @@
+package irc
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Badge is a single entry of the badges or badge-info tag, such as subscriber/12
+type Badge struct {
+	Name    string
+	Version string
+}
+
+type Badges []Badge
+
+func parseBadges(tag string) Badges {
+	if tag == "" {
+		return Badges{}
+	}
+
+	split := strings.Split(tag, ",")
+	badges := make(Badges, 0, len(split))
+
+	for _, badge := range split {
+		if badge == "" {
+			continue
+		}
+
+		name, version, _ := strings.Cut(badge, "/")
+
+		badges = append(badges, Badge{
+			Name:    name,
+			Version: version,
+		})
+	}
+
+	return badges
+}
+
+func (b Badges) Get(name string) (Badge, bool) {
+	for _, badge := range b {
+		if badge.Name == name {
+			return badge, true
+		}
+	}
+
+	return Badge{}, false
+}
+
+func (b Badges) Has(name string) bool {
+	_, ok := b.Get(name)
+
+	return ok
+}
+
+// VersionInt returns the version as a number, such as the months in subscriber/12
+func (b Badge) VersionInt() int {
+	v, _ := strconv.Atoi(b.Version)
+
+	return v
+}
@@ -1,38 +1,73 @@
 package irc
 
 import (
+	"errors"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
 
+var (
+	ErrConnectTimeout   = errors.New("timed out waiting for the server to accept the connection")
+	ErrConnectionClosed = errors.New("connection closed before the server accepted it")
+	ErrRetriesExhausted = errors.New("gave up reconnecting to the server")
+	ErrClosed           = errors.New("connection has been closed")
+	ErrLoginFailed      = errors.New("login authentication failed")
+)
+
+const (
+	READY_TIMEOUT = 30 * time.Second
+)
+
 type IrcConnection struct {
+	// Address is dialed with Dial, so its scheme picks the transport
 	Address  string
 	User     string
 	Password string
+	Backoff  Backoff
 
 	Read       chan string
 	RecvPong   chan bool
 	MsgHasRecv chan bool
-	isReady    chan bool
 
-	Conn       *websocket.Conn
+	Conn       Transport
 	SendMtx    sync.Mutex
 	ChannelMtx sync.Mutex
 
 	MessageSubscriber func(*PrivmsgMessage)
+	subscribers       map[MessageType][]*subscription
+	subscriberMtx     sync.Mutex
+	// StateSubscriber is called from the reading goroutine, so it must not block
+	StateSubscriber func(ConnectionState)
 
 	ConnectedChannels []string
+	joinWaiters       map[string][]*joinWaiter
+
+	scheduler *sendScheduler
+
+	loginFailed atomic.Bool
+
+	state     ConnectionState
+	stateMtx  sync.Mutex
+	readyCh   chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 func NewClient(username, password string) *IrcConnection {
+	return newClient(username, password, newRateLimits(JoinLimitAnonymous))
+}
+
+// newClient creates a connection sending within limits, which it may share with other connections
+func newClient(username, password string, limits *rateLimits) *IrcConnection {
 	c := &IrcConnection{
 		Address:  CONNECTION_ADDRESS,
 		User:     username,
 		Password: password,
+		Backoff:  DefaultBackoff,
 
 		Read:       make(chan string),
 		MsgHasRecv: make(chan bool),
@@ -42,6 +77,14 @@ func NewClient(username, password string) *IrcConnection {
 		ChannelMtx: sync.Mutex{},
 
 		ConnectedChannels: make([]string, 0),
+		joinWaiters:       make(map[string][]*joinWaiter),
+
+		subscribers: make(map[MessageType][]*subscription),
+		scheduler:   newSendScheduler(limits),
+
+		state:   StateDisconnected,
+		readyCh: make(chan struct{}),
+		closed:  make(chan struct{}),
 	}
 
 	return c
@@ -51,24 +94,149 @@ func (c *IrcConnection) OnMessage(cb func(msg *PrivmsgMessage)) {
 	c.MessageSubscriber = cb
 }
 
+type subscription struct {
+	cb func(Message)
+}
+
+// Subscribe calls cb for every message of the given type, it returns a function which removes the subscription.
+//
+// cb is called from the reading goroutine, so it must not block.
+func (c *IrcConnection) Subscribe(t MessageType, cb func(Message)) func() {
+	sub := &subscription{cb}
+
+	c.subscriberMtx.Lock()
+	c.subscribers[t] = append(c.subscribers[t], sub)
+	c.subscriberMtx.Unlock()
+
+	return func() {
+		c.subscriberMtx.Lock()
+		defer c.subscriberMtx.Unlock()
+
+		subs := c.subscribers[t]
+		for i, s := range subs {
+			if s == sub {
+				c.subscribers[t] = append(subs[:i:i], subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (c *IrcConnection) dispatch(msg Message) {
+	c.subscriberMtx.Lock()
+	subs := c.subscribers[msg.GetType()]
+	c.subscriberMtx.Unlock()
+
+	for _, sub := range subs {
+		sub.cb(msg)
+	}
+}
+
+func (c *IrcConnection) OnStateChange(cb func(state ConnectionState)) {
+	c.stateMtx.Lock()
+	defer c.stateMtx.Unlock()
+
+	c.StateSubscriber = cb
+}
+
+func (c *IrcConnection) State() ConnectionState {
+	c.stateMtx.Lock()
+	defer c.stateMtx.Unlock()
+
+	return c.state
+}
+
+func (c *IrcConnection) setState(state ConnectionState) {
+	c.stateMtx.Lock()
+
+	if c.state == state || c.state == StateClosed {
+		c.stateMtx.Unlock()
+		return
+	}
+
+	if state == StateReady {
+		close(c.readyCh)
+	} else if c.state == StateReady {
+		c.readyCh = make(chan struct{})
+	}
+
+	c.state = state
+	cb := c.StateSubscriber
+
+	c.stateMtx.Unlock()
+
+	if cb != nil {
+		cb(state)
+	}
+}
+
+// ready returns a channel which is closed once the connection is ready
+func (c *IrcConnection) ready() chan struct{} {
+	c.stateMtx.Lock()
+	defer c.stateMtx.Unlock()
+
+	return c.readyCh
+}
+
+// Connect opens the connection and blocks until the server has accepted it.
+//
+// Once connected the connection is supervised, if it drops it is reopened
+// following the Backoff and every channel that was joined is joined again.
 func (c *IrcConnection) Connect() error {
-	conn, _, err := websocket.DefaultDialer.Dial(c.Address, nil)
+	done, err := c.connect()
 	if err != nil {
+		c.setState(StateDisconnected)
 		return err
 	}
 
+	// Only once connected, the queues run until the connection is closed and a failed one never is
+	c.scheduler.start(c)
+
+	go c.supervise(done)
+
+	return nil
+}
+
+// connect opens a single socket, the returned channel is closed when it dies.
+func (c *IrcConnection) connect() (chan struct{}, error) {
+	select {
+	case <-c.closed:
+		return nil, ErrClosed
+	default:
+	}
+
+	c.setState(StateConnecting)
+	c.loginFailed.Store(false)
+
+	conn, err := Dial(c.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	c.SendMtx.Lock()
 	c.Conn = conn
-	c.isReady = make(chan bool)
+	c.SendMtx.Unlock()
+
+	ready := c.ready()
+	done := make(chan struct{})
 
-	wg := sync.WaitGroup{}
+	eof := make(chan struct{})
 
-	go c.handlePong(&wg)
-	go c.readLoop(&wg)
+	go c.handlePong(conn, done)
+	go c.readLoop(conn, eof)
 
+	// done is closed from here rather than the read loop,
+	// so every line it read has been handled once done is closed.
 	go func() {
+		defer close(done)
+
 		for {
-			msg := <-c.Read
-			c.handleLine(msg)
+			select {
+			case <-eof:
+				return
+			case msg := <-c.Read:
+				c.handleLine(msg)
+			}
 		}
 	}()
 
@@ -76,24 +244,128 @@ func (c *IrcConnection) Connect() error {
 	c.Send("NICK " + c.User)
 	c.Send("CAP REQ :twitch.tv/tags twitch.tv/membership")
 
-	<-c.isReady
+	select {
+	case <-ready:
+		return done, nil
+	case <-done:
+		if c.loginFailed.Load() {
+			return nil, ErrLoginFailed
+		}
 
-	return nil
+		return nil, ErrConnectionClosed
+	case <-time.After(READY_TIMEOUT):
+		conn.Close()
+		return nil, ErrConnectTimeout
+	}
+}
+
+func (c *IrcConnection) supervise(done chan struct{}) {
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-done:
+		}
+
+		select {
+		case <-c.closed:
+			return
+		default:
+		}
+
+		c.ChannelMtx.Lock()
+		channels := c.ConnectedChannels
+		c.ConnectedChannels = make([]string, 0, len(channels))
+		c.ChannelMtx.Unlock()
+
+		c.setState(StateDisconnected)
+
+		zap.S().Warnw("Lost connection to server, reconnecting", "user", c.User, "channels", len(channels))
+
+		var err error
+		done, err = c.reconnect()
+		if err != nil {
+			zap.S().Errorw("Failed to reconnect to server", "user", c.User, "error", err)
+
+			// Hand the channels back so whoever owns the connection can move them elsewhere.
+			c.ChannelMtx.Lock()
+			c.ConnectedChannels = channels
+			c.ChannelMtx.Unlock()
+
+			c.closeOnce.Do(func() { close(c.closed) })
+			c.setState(StateClosed)
+
+			return
+		}
+
+		zap.S().Infow("Reconnected to server, rejoining channels", "user", c.User, "channels", len(channels))
+
+		for _, channel := range channels {
+			c.Join(channel)
+		}
+	}
+}
+
+func (c *IrcConnection) reconnect() (chan struct{}, error) {
+	for attempt := 0; c.Backoff.MaxRetries <= 0 || attempt < c.Backoff.MaxRetries; attempt++ {
+		wait := c.Backoff.Duration(attempt)
+
+		select {
+		case <-c.closed:
+			return nil, ErrClosed
+		case <-time.After(wait):
+		}
+
+		done, err := c.connect()
+		if err == nil {
+			return done, nil
+		}
+
+		if err == ErrLoginFailed {
+			// Retrying will not make the credentials valid
+			return nil, err
+		}
+
+		c.setState(StateDisconnected)
+
+		zap.S().Warnw("Reconnect attempt failed", "user", c.User, "attempt", attempt+1, "error", err)
+	}
+
+	return nil, ErrRetriesExhausted
 }
 
+// Disconnect closes the connection for good, it will not reconnect.
 func (c *IrcConnection) Disconnect() error {
-	return c.Conn.Close()
+	c.closeOnce.Do(func() { close(c.closed) })
+	c.setState(StateClosed)
+
+	c.SendMtx.Lock()
+	conn := c.Conn
+	c.SendMtx.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	return conn.Close()
 }
 
+// Reconnect drops the current socket, the supervisor will open a new one.
 func (c *IrcConnection) Reconnect() {
-	c.Conn.Close()
+	c.SendMtx.Lock()
+	conn := c.Conn
+	c.SendMtx.Unlock()
 
-	c.Connect()
+	if conn != nil {
+		conn.Close()
+	}
 }
 
-func (c *IrcConnection) handlePong(wg *sync.WaitGroup) {
+func (c *IrcConnection) handlePong(conn Transport, done chan struct{}) {
 	for {
 		select {
+		case <-done:
+			return
 		case <-c.MsgHasRecv:
 			continue
 		case <-time.After(4 * time.Minute):
@@ -101,11 +373,15 @@ func (c *IrcConnection) handlePong(wg *sync.WaitGroup) {
 				c.Send("PING : HI-:D")
 
 				select {
+				case <-done:
+					return
 				case <-c.RecvPong:
 					continue
 				case <-time.After(10 * time.Second):
 					{
-						zap.S().Errorw("Failed to receive pong from server")
+						zap.S().Errorw("Failed to receive pong from server, reconnecting")
+						conn.Close()
+						return
 					}
 				}
 			}
@@ -113,38 +389,31 @@ func (c *IrcConnection) handlePong(wg *sync.WaitGroup) {
 	}
 }
 
-func (c *IrcConnection) readLoop(wg *sync.WaitGroup) {
+func (c *IrcConnection) readLoop(conn Transport, eof chan struct{}) {
 	defer func() {
-		c.Conn.Close()
+		conn.Close()
+		close(eof)
 	}()
 
 	for {
-		msgType, msg, err := c.Conn.ReadMessage()
+		line, err := conn.ReadLine()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				zap.S().Errorw("Unexpected close from websocket error", "error", err)
-			} else if err == websocket.ErrCloseSent {
-				zap.S().Errorw("Close sent from websocket error", "error", err)
-				c.Reconnect()
-			} else {
-				zap.S().Errorw("Failed to read message from server", "error", err)
+			select {
+			case <-c.closed:
+				return
+			default:
 			}
-			return
 
-			/*
-				TODO: Stuck forever if theres an error before MOTD
-			*/
+			zap.S().Errorw("Failed to read message from server", "error", err)
+
+			return
 		}
 
-		if msgType != websocket.TextMessage {
-			zap.S().Errorw("Received non-text message from server", "type", msgType)
+		if line == "" {
 			continue
 		}
 
-		lines := strings.Split(string(msg), "\r\n")
-		for _, line := range lines {
-			c.Read <- line
-		}
+		c.Read <- line
 	}
 }
 
@@ -162,6 +431,8 @@ func (c *IrcConnection) handleLine(line string) {
 		return
 	}
 
+	defer c.dispatch(parsed)
+
 	switch parsed.GetType() {
 	case PONG:
 		{
@@ -191,16 +462,31 @@ func (c *IrcConnection) handleLine(line string) {
 	case ENDOFMOTD:
 		{
 			zap.S().Infow("Connected to server")
-			c.isReady <- true
+			c.setState(StateReady)
 		}
 	case NOTICE:
 		{
 			msg := parsed.(*NoticeMessage)
 
-			if strings.HasPrefix(msg.Message, "Login authentication failed") {
-				zap.S().Errorw("Failed to authenticate with server")
+			if strings.HasPrefix(msg.Message, "Login authentication failed") || strings.HasPrefix(msg.Message, "Improperly formatted auth") {
+				zap.S().Errorw("Failed to authenticate with server", "user", c.User)
+				c.loginFailed.Store(true)
+			}
+
+			if res, ok := joinNotices[msg.Tags["msg-id"]]; ok {
+				zap.S().Warnw("Failed to join channel", "channel", msg.Channel, "reason", res)
+
+				c.ChannelMtx.Lock()
+				c.resolveJoin(msg.Channel, res)
+				c.ChannelMtx.Unlock()
 			}
 		}
+	case USERSTATE:
+		{
+			msg := parsed.(*UserStateMessage)
+
+			c.SetModerator(msg.Channel, msg.IsModerator())
+		}
 	case JOIN:
 		{
 			msg := parsed.(*JoinMessage)
@@ -213,6 +499,15 @@ func (c *IrcConnection) handleLine(line string) {
 			defer c.ChannelMtx.Unlock()
 
 			zap.S().Infow("Joined channel", "channel", msg.Channel)
+
+			c.resolveJoin(msg.Channel, JoinSuccess)
+
+			for _, channel := range c.ConnectedChannels {
+				if channel == msg.Channel {
+					return
+				}
+			}
+
 			c.ConnectedChannels = append(c.ConnectedChannels, msg.Channel)
 		}
 	case PART:
@@ -228,13 +523,13 @@ func (c *IrcConnection) handleLine(line string) {
 
 			zap.S().Infow("Left channel", "channel", msg.Channel)
 
-			newChannels := make([]string, len(c.ConnectedChannels)-1)
-			for i, channel := range c.ConnectedChannels {
+			newChannels := make([]string, 0, len(c.ConnectedChannels))
+			for _, channel := range c.ConnectedChannels {
 				if channel == msg.Channel {
 					continue
 				}
 
-				newChannels[i] = channel
+				newChannels = append(newChannels, channel)
 			}
 
 			c.ConnectedChannels = newChannels
@@ -259,7 +554,35 @@ func (c *IrcConnection) Part(channel string) {
 	c.Send("PART #" + channel)
 }
 
+// Send writes a command to the server.
+//
+// JOIN and PRIVMSG are queued and sent when their rate limit allows it,
+// everything else is written immediately.
 func (c *IrcConnection) Send(msg string) {
+	if q := c.scheduler.queueFor(msg); q != nil {
+		q.push(msg)
+		return
+	}
+
+	c.write(msg)
+}
+
+// SendWithTags sends a command prefixed with client tags, such as reply-parent-msg-id.
+func (c *IrcConnection) SendWithTags(tags Tags, msg string) {
+	if len(tags) == 0 {
+		c.Send(msg)
+		return
+	}
+
+	c.Send(tags.String() + " " + msg)
+}
+
+// Reply sends a message in channel as a reply to the message with the id parentID.
+func (c *IrcConnection) Reply(channel, parentID, message string) {
+	c.SendWithTags(Tags{"reply-parent-msg-id": parentID}, "PRIVMSG #"+channel+" :"+message)
+}
+
+func (c *IrcConnection) write(msg string) {
 	c.SendMtx.Lock()
 	defer c.SendMtx.Unlock()
 
@@ -267,10 +590,18 @@ func (c *IrcConnection) Send(msg string) {
 		zap.S().Debugw("Sending message", "message", msg)
 	}
 
-	err := c.Conn.WriteMessage(websocket.TextMessage, []byte(msg))
+	if c.Conn == nil {
+		zap.S().Errorw("Failed to send message to server", "error", "not connected")
+		return
+	}
+
+	err := c.Conn.WriteLine(msg)
 	if err != nil {
 		zap.S().Errorw("Failed to send message to server", "error", err)
+		return
 	}
+
+	c.markJoinSent(msg)
 }
 
 func (c *IrcConnection) IsConnectedToChannel(channel string) bool {
@@ -0,0 +1,54 @@
+package irc
+
+import "testing"
+
+func TestSubscribe(t *testing.T) {
+	c := NewClient(DEFAULT_USERNAME, DEFAULT_PASSWORD)
+
+	var got []Message
+	unsubscribe := c.Subscribe(CLEARMSG, func(msg Message) {
+		got = append(got, msg)
+	})
+
+	c.handleLine("@login=markzynk;target-msg-id=abc :tmi.twitch.tv CLEARMSG #forsen :AlienPls")
+	c.handleLine(":markzynk!markzynk@markzynk.tmi.twitch.tv PRIVMSG #forsen :AlienPls")
+
+	if len(got) != 1 {
+		t.Fatalf("got %d messages, want 1", len(got))
+	}
+
+	if msg := got[0].(*ClearMsgMessage); msg.TargetMsgID != "abc" {
+		t.Errorf("got %v, want abc", msg.TargetMsgID)
+	}
+
+	unsubscribe()
+
+	c.handleLine("@login=markzynk;target-msg-id=def :tmi.twitch.tv CLEARMSG #forsen :AlienPls")
+
+	if len(got) != 1 {
+		t.Errorf("got %d messages, want 1 after unsubscribing", len(got))
+	}
+}
+
+func TestJoinPartTracksChannels(t *testing.T) {
+	c := NewClient(DEFAULT_USERNAME, DEFAULT_PASSWORD)
+
+	c.handleLine(":justinfan123!justinfan123@justinfan123.tmi.twitch.tv JOIN #forsen")
+	c.handleLine(":justinfan123!justinfan123@justinfan123.tmi.twitch.tv JOIN #pajlada")
+	c.handleLine(":justinfan123!justinfan123@justinfan123.tmi.twitch.tv JOIN #forsen")
+	c.handleLine(":markzynk!markzynk@markzynk.tmi.twitch.tv JOIN #xqc")
+
+	if len(c.ConnectedChannels) != 2 {
+		t.Fatalf("got %v, want forsen and pajlada", c.ConnectedChannels)
+	}
+
+	c.handleLine(":justinfan123!justinfan123@justinfan123.tmi.twitch.tv PART #forsen")
+
+	if len(c.ConnectedChannels) != 1 || c.ConnectedChannels[0] != "pajlada" {
+		t.Errorf("got %v, want pajlada", c.ConnectedChannels)
+	}
+
+	if c.IsConnectedToChannel("forsen") {
+		t.Errorf("still connected to forsen after parting")
+	}
+}
@@ -0,0 +1,85 @@
+package irc
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Emote is a native Twitch emote inside a message.
+//
+// Start and End are rune indexes into the message, End is exclusive,
+// so the emote is []rune(message)[Start:End].
+type Emote struct {
+	ID    string
+	Name  string
+	Start int
+	End   int
+}
+
+// parseEmotes parses the emotes tag, e.g. 25:0-4,12-16/1902:6-10
+//
+// Twitch counts positions in UTF-16 code units, which differs from runes once
+// a message contains characters outside the basic multilingual plane, such as most emojis.
+func parseEmotes(tag, message string) []Emote {
+	if tag == "" {
+		return []Emote{}
+	}
+
+	runes := []rune(message)
+
+	// utf16ToRune[i] is the rune the i'th UTF-16 code unit belongs to
+	utf16ToRune := make([]int, 0, len(runes))
+	for i, r := range runes {
+		utf16ToRune = append(utf16ToRune, i)
+
+		if r >= 0x10000 {
+			utf16ToRune = append(utf16ToRune, i)
+		}
+	}
+
+	emotes := make([]Emote, 0)
+
+	for _, emote := range strings.Split(tag, "/") {
+		id, positions, ok := strings.Cut(emote, ":")
+		if !ok || id == "" {
+			continue
+		}
+
+		for _, position := range strings.Split(positions, ",") {
+			startStr, endStr, ok := strings.Cut(position, "-")
+			if !ok {
+				continue
+			}
+
+			start, err := strconv.Atoi(startStr)
+			if err != nil {
+				continue
+			}
+
+			end, err := strconv.Atoi(endStr)
+			if err != nil {
+				continue
+			}
+
+			if start < 0 || end < start || end >= len(utf16ToRune) {
+				continue
+			}
+
+			e := Emote{
+				ID:    id,
+				Start: utf16ToRune[start],
+				End:   utf16ToRune[end] + 1,
+			}
+			e.Name = string(runes[e.Start:e.End])
+
+			emotes = append(emotes, e)
+		}
+	}
+
+	sort.Slice(emotes, func(i, j int) bool {
+		return emotes[i].Start < emotes[j].Start
+	})
+
+	return emotes
+}
@@ -0,0 +1,55 @@
+package irc
+
+import "testing"
+
+func TestParseEmotes(t *testing.T) {
+	testCases := []struct {
+		Tag     string
+		Message string
+		Want    []Emote
+	}{
+		{
+			Tag:     "",
+			Message: "AlienPls",
+			Want:    []Emote{},
+		},
+		{
+			Tag:     "25:0-4,12-16/1902:6-10",
+			Message: "Kappa Keepo Kappa",
+			Want: []Emote{
+				{ID: "25", Name: "Kappa", Start: 0, End: 5},
+				{ID: "1902", Name: "Keepo", Start: 6, End: 11},
+				{ID: "25", Name: "Kappa", Start: 12, End: 17},
+			},
+		},
+		{
+			// 👍 is two UTF-16 code units but a single rune
+			Tag:     "25:3-7",
+			Message: "👍 Kappa",
+			Want: []Emote{
+				{ID: "25", Name: "Kappa", Start: 2, End: 7},
+			},
+		},
+		{
+			Tag:     "25:0-4/bad/1902:100-104/:1-2/30:a-b",
+			Message: "Kappa",
+			Want: []Emote{
+				{ID: "25", Name: "Kappa", Start: 0, End: 5},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		got := parseEmotes(testCase.Tag, testCase.Message)
+
+		if len(got) != len(testCase.Want) {
+			t.Fatalf("%s: got %d emotes, want %d", testCase.Tag, len(got), len(testCase.Want))
+		}
+
+		for i, want := range testCase.Want {
+			if got[i] != want {
+				t.Errorf("%s: got %+v, want %+v", testCase.Tag, got[i], want)
+			}
+		}
+	}
+}
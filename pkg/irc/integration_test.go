@@ -0,0 +1,263 @@
+package irc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/JoachimFlottorp/magnolia/internal/config"
+	"github.com/JoachimFlottorp/magnolia/internal/ctx"
+	"github.com/JoachimFlottorp/magnolia/pkg/irc"
+	"github.com/JoachimFlottorp/magnolia/pkg/irc/irctest"
+)
+
+const (
+	testTimeout = 5 * time.Second
+)
+
+var (
+	testBackoff = irc.Backoff{Min: 10 * time.Millisecond, Max: 50 * time.Millisecond, Factor: 2, MaxRetries: 3}
+)
+
+func connectClient(t *testing.T, srv *irctest.Server) (*irc.IrcConnection, *irctest.Client) {
+	t.Helper()
+
+	c := irc.NewClient(irc.DEFAULT_USERNAME, irc.DEFAULT_PASSWORD)
+	c.Address = srv.URL
+	c.Backoff = testBackoff
+
+	if err := c.Connect(); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+
+	t.Cleanup(func() { c.Disconnect() })
+
+	sc, err := srv.WaitForClient(testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c, sc
+}
+
+func waitForState(t *testing.T, c *irc.IrcConnection, want irc.ConnectionState) {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for c.State() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("got state %s, want %s", c.State(), want)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConnectAndJoin(t *testing.T) {
+	srv := irctest.NewServer()
+	defer srv.Close()
+
+	c, sc := connectClient(t, srv)
+
+	if sc.Nick != irc.DEFAULT_USERNAME || sc.Pass != irc.DEFAULT_PASSWORD {
+		t.Errorf("got nick %q and pass %q", sc.Nick, sc.Pass)
+	}
+
+	if _, err := sc.WaitFor("CAP REQ", testTimeout); err != nil {
+		t.Errorf("never requested capabilities: %v", err)
+	}
+
+	if res := c.JoinAndWait("forsen", testTimeout); res != irc.JoinSuccess {
+		t.Fatalf("got %s, want %s", res, irc.JoinSuccess)
+	}
+
+	if !c.IsConnectedToChannel("forsen") {
+		t.Errorf("client does not think it is in forsen")
+	}
+
+	c.Part("forsen")
+
+	if _, err := sc.WaitFor("PART #forsen", testTimeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJoinSuspendedChannel(t *testing.T) {
+	srv := irctest.NewServer()
+	srv.Suspended = []string{"suspended"}
+	defer srv.Close()
+
+	c, _ := connectClient(t, srv)
+
+	if res := c.JoinAndWait("suspended", testTimeout); res != irc.JoinSuspended {
+		t.Errorf("got %s, want %s", res, irc.JoinSuspended)
+	}
+}
+
+func TestLoginFailed(t *testing.T) {
+	srv := irctest.NewServer()
+	srv.FailLogin = true
+	defer srv.Close()
+
+	c := irc.NewClient("forsen", "oauth:wrong")
+	c.Address = srv.URL
+
+	if err := c.Connect(); err != irc.ErrLoginFailed {
+		t.Errorf("got %v, want %v", err, irc.ErrLoginFailed)
+	}
+}
+
+func TestRespondsToPing(t *testing.T) {
+	srv := irctest.NewServer()
+	defer srv.Close()
+
+	_, sc := connectClient(t, srv)
+
+	sc.Send("PING :tmi.twitch.tv")
+
+	if _, err := sc.WaitFor("PONG", testTimeout); err != nil {
+		t.Errorf("never answered the ping: %v", err)
+	}
+}
+
+func TestReceivesMessages(t *testing.T) {
+	srv := irctest.NewServer()
+	defer srv.Close()
+
+	c, sc := connectClient(t, srv)
+
+	got := make(chan *irc.PrivmsgMessage, 1)
+	c.OnMessage(func(msg *irc.PrivmsgMessage) {
+		got <- msg
+	})
+
+	sc.Privmsg("forsen", "markzynk", "AlienPls")
+
+	select {
+	case msg := <-got:
+		if msg.Channel != "forsen" || msg.User != "markzynk" || msg.Message != "AlienPls" {
+			t.Errorf("got %+v", msg)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("never received the message")
+	}
+}
+
+func TestRejoinsAfterDrop(t *testing.T) {
+	testCases := []struct {
+		Name string
+		Drop func(sc *irctest.Client)
+	}{
+		{"reconnect", func(sc *irctest.Client) { sc.Reconnect() }},
+		{"disconnect", func(sc *irctest.Client) { sc.Disconnect() }},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			srv := irctest.NewServer()
+			defer srv.Close()
+
+			c, sc := connectClient(t, srv)
+
+			if res := c.JoinAndWait("forsen", testTimeout); res != irc.JoinSuccess {
+				t.Fatalf("got %s, want %s", res, irc.JoinSuccess)
+			}
+
+			testCase.Drop(sc)
+
+			again, err := srv.WaitForClient(testTimeout)
+			if err != nil {
+				t.Fatalf("never reconnected: %v", err)
+			}
+
+			if _, err := again.WaitFor("JOIN #forsen", testTimeout); err != nil {
+				t.Fatalf("never rejoined: %v", err)
+			}
+
+			waitForState(t, c, irc.StateReady)
+		})
+	}
+}
+
+func TestGivesUpReconnecting(t *testing.T) {
+	srv := irctest.NewServer()
+
+	c, _ := connectClient(t, srv)
+
+	srv.Close()
+
+	waitForState(t, c, irc.StateClosed)
+}
+
+func TestJoinRateLimit(t *testing.T) {
+	srv := irctest.NewServer()
+	defer srv.Close()
+
+	c, sc := connectClient(t, srv)
+	c.SetJoinLimit(irc.RateLimit{Count: 2, Period: 400 * time.Millisecond})
+
+	start := time.Now()
+
+	for _, channel := range []string{"a", "b", "c", "d"} {
+		c.Join(channel)
+	}
+
+	if _, err := sc.WaitFor("JOIN #d", testTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two joins go out at once, the other two wait for a token each
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("all joins were sent after %v, want the rate limit to hold them back", elapsed)
+	}
+}
+
+func TestManagerSpreadsChannels(t *testing.T) {
+	srv := irctest.NewServer()
+	defer srv.Close()
+
+	gCtx, cancel := ctx.WithCancel(ctx.New(context.Background(), &config.Config{}))
+	defer cancel()
+
+	m := irc.NewManager(gCtx, irc.ManagerOptions{
+		Address:               srv.URL,
+		ChannelsPerConnection: 2,
+	})
+
+	for _, channel := range []string{"a", "b", "c", "d", "e"} {
+		if res := m.JoinChannel(channel); res != irc.JoinSuccess {
+			t.Fatalf("%s: got %s, want %s", channel, res, irc.JoinSuccess)
+		}
+	}
+
+	stats := m.ConnectionStats()
+	if len(stats) != 3 {
+		t.Fatalf("got %d connections, want 3", len(stats))
+	}
+
+	for _, stat := range stats {
+		if stat.Channels > 2 {
+			t.Errorf("connection %d owns %d channels, want at most 2", stat.ID, stat.Channels)
+		}
+	}
+
+	clients := srv.Clients()
+	clients[2].Privmsg("e", "markzynk", "AlienPls")
+
+	select {
+	case msg := <-m.MessageQueue:
+		if msg.Channel != "e" {
+			t.Errorf("got message from %s, want e", msg.Channel)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("message was not forwarded")
+	}
+
+	m.LeaveChannel("e")
+
+	select {
+	case <-clients[2].Closed():
+	case <-time.After(testTimeout):
+		t.Errorf("idle connection was not closed")
+	}
+}
@@ -1,7 +1,9 @@
 package irc
 
 import (
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/JoachimFlottorp/magnolia/internal/ctx"
 	"github.com/JoachimFlottorp/magnolia/internal/mongo"
@@ -15,24 +17,92 @@ const (
 	DEFAULT_PASSWORD   = "XDDDDDD"
 
 	MAX_CHANNELS_PER_CONN = 100
+
+	REBALANCE_INTERVAL = 10 * time.Minute
+	// MOVE_JOIN_TIMEOUT is how long a moved channel may take to join its new connection
+	MOVE_JOIN_TIMEOUT = 1 * time.Minute
+
+	// JOIN_TIMEOUT is how long Twitch has to answer a JOIN once it has been sent
+	JOIN_TIMEOUT = 30 * time.Second
+	JOIN_RETRIES = 3
 )
 
+// ManagerOptions decides which account the manager connects with.
+//
+// Without a username the manager connects anonymously,
+// an account without a tier is treated as a normal account.
+type ManagerOptions struct {
+	Username string
+	Password string
+	Tier     Tier
+	// Address overrides CONNECTION_ADDRESS when set
+	Address string
+	// JoinLimit overrides the JOIN budget of the tier when set, it does not apply to anonymous connections
+	JoinLimit RateLimit
+	// ChannelsPerConnection overrides MAX_CHANNELS_PER_CONN when set.
+	//
+	// Twitch does not publish how many channels a connection can be in, so every tier gets the same default
+	ChannelsPerConnection int
+}
+
 type IrcManager struct {
-	ctx ctx.Context
+	ctx  ctx.Context
+	opts ManagerOptions
 
 	conns []*IrcConnection
-	mtx   sync.Mutex
+	// channels is which connection owns a channel, only the owner forwards its messages
+	channels map[string]*IrcConnection
+	ids      map[*IrcConnection]int
+	nextID   int
+	// limits are shared by the connections, as Twitch rate limits the account rather than the socket
+	limits *rateLimits
+	// dialing is the connections still connecting, they are dialed without holding mtx
+	dialing map[*IrcConnection]*dial
+	mtx     sync.Mutex
 
-	joinQueue    chan string
 	MessageQueue chan *PrivmsgMessage
+
+	subscribers []managerSubscription
+}
+
+// dial is done once its connection is ready or failed to connect
+type dial struct {
+	done chan struct{}
+	err  error
 }
 
-func NewManager(gCtx ctx.Context) *IrcManager {
+type managerSubscription struct {
+	t  MessageType
+	cb func(Message)
+}
+
+// ConnectionStats describes a single connection in the pool
+type ConnectionStats struct {
+	ID    int    `json:"id"`
+	State string `json:"state"`
+	// Channels is the amount of channels the connection owns
+	Channels int `json:"channels"`
+	// Joined is the amount of channels Twitch confirmed we are in
+	Joined     int `json:"joined"`
+	QueueDepth int `json:"queue_depth"`
+}
+
+func NewManager(gCtx ctx.Context, opts ManagerOptions) *IrcManager {
+	if opts.Username == "" {
+		opts = anonymousOptions(opts)
+	} else if opts.Tier == TierAnonymous {
+		opts.Tier = TierNormal
+	}
+
 	m := &IrcManager{
 		ctx:          gCtx,
+		opts:         opts,
 		conns:        make([]*IrcConnection, 0),
+		channels:     make(map[string]*IrcConnection),
+		ids:          make(map[*IrcConnection]int),
+		limits:       newRateLimits(opts.joinLimit()),
+		dialing:      make(map[*IrcConnection]*dial),
 		mtx:          sync.Mutex{},
-		joinQueue:    make(chan string),
 		MessageQueue: make(chan *PrivmsgMessage),
 	}
 
@@ -41,16 +111,8 @@ func NewManager(gCtx ctx.Context) *IrcManager {
 			select {
 			case <-gCtx.Done():
 				return
-			case channel := <-m.joinQueue:
-				{
-					conn, err := m.availableConnector()
-					if err != nil {
-						zap.S().Errorw("Failed to join channel", "channel", channel, "error", err)
-						continue
-					}
-
-					conn.Join(channel)
-				}
+			case <-time.After(REBALANCE_INTERVAL):
+				m.Rebalance()
 			}
 		}
 	}()
@@ -58,6 +120,7 @@ func NewManager(gCtx ctx.Context) *IrcManager {
 	return m
 }
 
+// ConnectAllFromDatabase joins every stored channel in the background and records how it went.
 func (m *IrcManager) ConnectAllFromDatabase() error {
 	cursor, err := m.ctx.Inst().Mongo.Collection(mongo.CollectionTwitch).Find(m.ctx, bson.D{})
 	if err != nil {
@@ -70,51 +133,489 @@ func (m *IrcManager) ConnectAllFromDatabase() error {
 	}
 
 	for _, channel := range channels {
-		conn, err := m.availableConnector()
+		go func(channel mongo.TwitchChannel) {
+			res := m.JoinChannel(channel.TwitchName)
+
+			if err := channel.SetJoinStatus(m.ctx, m.ctx.Inst().Mongo, res.Error()); err != nil {
+				zap.S().Errorw("Failed to save join status", "channel", channel.TwitchName, "error", err)
+			}
+		}(channel)
+	}
+
+	return nil
+}
+
+// JoinChannel joins the channel and blocks until Twitch confirmed or rejected it.
+//
+// Timeouts and lost connections are retried, a channel which could not be joined is forgotten.
+func (m *IrcManager) JoinChannel(channel string) JoinResult {
+	res := JoinFailed
+
+	for attempt := 0; attempt < JOIN_RETRIES; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-m.ctx.Done():
+				return res
+			case <-time.After(DefaultBackoff.Duration(attempt)):
+			}
+		}
+
+		conn, err := m.join(channel)
 		if err != nil {
-			return err
+			zap.S().Errorw("Failed to join channel", "channel", channel, "error", err)
+			continue
+		}
+
+		res = conn.JoinAndWait(channel, JOIN_TIMEOUT)
+		if res == JoinSuccess {
+			return res
+		}
+
+		m.mtx.Lock()
+		if m.channels[channel] == conn {
+			delete(m.channels, channel)
 		}
+		m.mtx.Unlock()
 
-		conn.Join(channel.TwitchName)
+		if !res.Transient() {
+			break
+		}
+
+		zap.S().Warnw("Retrying join", "channel", channel, "reason", res, "attempt", attempt+1)
 	}
 
-	return nil
+	zap.S().Errorw("Giving up joining channel", "channel", channel, "reason", res)
+
+	return res
 }
 
-func (m *IrcManager) availableConnector() (*IrcConnection, error) {
+// join gives the channel to a connection with room for it, waiting for the connection if it is still connecting
+func (m *IrcManager) join(channel string) (*IrcConnection, error) {
 	m.mtx.Lock()
-	defer m.mtx.Unlock()
+
+	conn, ok := m.channels[channel]
+	if !ok {
+		conn = m.availableConnector()
+		m.channels[channel] = conn
+	}
+
+	d := m.dialing[conn]
+	m.mtx.Unlock()
+
+	if d == nil {
+		return conn, nil
+	}
+
+	select {
+	case <-m.ctx.Done():
+		return nil, m.ctx.Err()
+	case <-d.done:
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return conn, nil
+}
+
+// ownedCounts returns how many channels each connection owns, m.mtx must be held
+func (m *IrcManager) ownedCounts() map[*IrcConnection]int {
+	counts := make(map[*IrcConnection]int, len(m.conns))
+
+	for _, conn := range m.channels {
+		counts[conn]++
+	}
+
+	return counts
+}
+
+// ownedBy returns the channels the connection owns, m.mtx must be held
+func (m *IrcManager) ownedBy(conn *IrcConnection) []string {
+	channels := make([]string, 0)
+
+	for channel, owner := range m.channels {
+		if owner == conn {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels
+}
+
+// availableConnector returns the first connection with room for another channel, m.mtx must be held
+func (m *IrcManager) availableConnector() *IrcConnection {
+	counts := m.ownedCounts()
 
 	for _, conn := range m.conns {
-		if len(conn.ConnectedChannels) < MAX_CHANNELS_PER_CONN {
-			return conn, nil
+		if conn.State() == StateClosed {
+			continue
+		}
+
+		if counts[conn] < m.channelLimit() {
+			return conn
 		}
 	}
 
 	return m.createNewConnector()
 }
 
-func (m *IrcManager) createNewConnector() (*IrcConnection, error) {
-	conn := NewClient(DEFAULT_USERNAME, DEFAULT_PASSWORD)
+func (m *IrcManager) channelLimit() int {
+	if m.opts.ChannelsPerConnection > 0 {
+		return m.opts.ChannelsPerConnection
+	}
+
+	return MAX_CHANNELS_PER_CONN
+}
+
+func (o ManagerOptions) joinLimit() RateLimit {
+	if o.JoinLimit.Count > 0 && o.JoinLimit.Period > 0 {
+		return o.JoinLimit
+	}
+
+	return o.Tier.JoinLimit()
+}
+
+func anonymousOptions(opts ManagerOptions) ManagerOptions {
+	return ManagerOptions{
+		Username:              DEFAULT_USERNAME,
+		Password:              DEFAULT_PASSWORD,
+		Tier:                  TierAnonymous,
+		Address:               opts.Address,
+		ChannelsPerConnection: opts.ChannelsPerConnection,
+	}
+}
+
+// createNewConnector adds a connection to the pool and dials it in the background, m.mtx must be held.
+//
+// Channels can be given to the connection right away, join waits for it to be ready.
+func (m *IrcManager) createNewConnector() *IrcConnection {
+	conn := m.newConnector()
+
+	m.conns = append(m.conns, conn)
+	m.ids[conn] = m.nextID
+	m.nextID++
+
+	d := &dial{done: make(chan struct{})}
+	m.dialing[conn] = d
+
+	go m.dial(conn, d)
+
+	return conn
+}
+
+// dial connects without holding m.mtx, so the other connections keep forwarding messages meanwhile.
+//
+// A connection which fails is dropped along with the channels given to it, JoinChannel tries them again.
+func (m *IrcManager) dial(conn *IrcConnection, d *dial) {
+	err := conn.Connect()
+
+	m.mtx.Lock()
+	delete(m.dialing, conn)
+
+	if err != nil {
+		if err == ErrLoginFailed && m.opts.Tier != TierAnonymous && conn.User == m.opts.Username {
+			zap.S().Warnw("Failed to log in, falling back to anonymous connections", "user", m.opts.Username)
+
+			m.opts = anonymousOptions(m.opts)
+			m.limits = newRateLimits(m.opts.joinLimit())
+		}
+
+		m.removeConnector(conn)
+	}
+
+	m.mtx.Unlock()
+
+	// Outside the lock, as closing calls onStateChange
+	if err != nil {
+		conn.Disconnect()
+	}
+
+	d.err = err
+	close(d.done)
+}
+
+// newConnector creates a connection which forwards the messages of the channels it owns, m.mtx must be held
+func (m *IrcManager) newConnector() *IrcConnection {
+	conn := newClient(m.opts.Username, m.opts.Password, m.limits)
+
+	if m.opts.Address != "" {
+		conn.Address = m.opts.Address
+	}
 
 	conn.OnMessage(func(msg *PrivmsgMessage) {
+		if !m.owns(conn, msg.Channel) {
+			return
+		}
+
 		m.MessageQueue <- msg
 	})
 
-	m.conns = append(m.conns, conn)
+	conn.OnStateChange(func(state ConnectionState) {
+		m.onStateChange(conn, state)
+	})
+
+	for _, sub := range m.subscribers {
+		conn.Subscribe(sub.t, sub.cb)
+	}
 
-	return conn, conn.Connect()
+	return conn
 }
 
-func (m *IrcManager) JoinChannel(channel mongo.TwitchChannel) {
-	m.joinQueue <- channel.TwitchName
+func (m *IrcManager) owns(conn *IrcConnection, channel string) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	return m.channels[channel] == conn
 }
 
-func (m *IrcManager) LeaveChannel(channel string) {
+// removeConnector drops the connection from the pool and returns the channels it owned, m.mtx must be held
+func (m *IrcManager) removeConnector(conn *IrcConnection) []string {
+	for i, c := range m.conns {
+		if c == conn {
+			m.conns = append(m.conns[:i], m.conns[i+1:]...)
+			break
+		}
+	}
+
+	delete(m.ids, conn)
+
+	channels := m.ownedBy(conn)
+	for _, channel := range channels {
+		delete(m.channels, channel)
+	}
+
+	return channels
+}
+
+func (m *IrcManager) onStateChange(conn *IrcConnection, state ConnectionState) {
+	zap.S().Infow("IRC connection changed state", "state", state)
+
+	if state != StateClosed {
+		return
+	}
+
+	m.mtx.Lock()
+	channels := m.removeConnector(conn)
+	m.mtx.Unlock()
+
+	if len(channels) == 0 {
+		return
+	}
+
+	zap.S().Warnw("IRC connection gave up, moving its channels", "channels", len(channels))
+
+	for _, channel := range channels {
+		go m.JoinChannel(channel)
+	}
+}
+
+// Subscribe calls cb for every message of the given type on every connection, including future ones.
+//
+// cb must not block, as it would stall reading from the connection.
+func (m *IrcManager) Subscribe(t MessageType, cb func(Message)) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.subscribers = append(m.subscribers, managerSubscription{t, cb})
+
+	for _, conn := range m.conns {
+		conn.Subscribe(t, cb)
+	}
+}
+
+// QueueDepth returns the amount of commands waiting for their rate limit across every connection.
+func (m *IrcManager) QueueDepth() int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	depth := 0
 	for _, conn := range m.conns {
-		if conn.IsConnectedToChannel(channel) {
-			conn.Part(channel)
+		depth += conn.QueueDepth()
+	}
+
+	return depth
+}
+
+// Channels returns every channel the manager is responsible for, sorted by name
+func (m *IrcManager) Channels() []string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	channels := make([]string, 0, len(m.channels))
+	for channel := range m.channels {
+		channels = append(channels, channel)
+	}
+
+	sort.Strings(channels)
+
+	return channels
+}
+
+// ConnectionStats describes every connection in the pool
+func (m *IrcManager) ConnectionStats() []ConnectionStats {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	counts := m.ownedCounts()
+	stats := make([]ConnectionStats, 0, len(m.conns))
+
+	for _, conn := range m.conns {
+		conn.ChannelMtx.Lock()
+		joined := len(conn.ConnectedChannels)
+		conn.ChannelMtx.Unlock()
+
+		stats = append(stats, ConnectionStats{
+			ID:         m.ids[conn],
+			State:      conn.State().String(),
+			Channels:   counts[conn],
+			Joined:     joined,
+			QueueDepth: conn.QueueDepth(),
+		})
+	}
+
+	return stats
+}
+
+func (m *IrcManager) LeaveChannel(channel string) {
+	m.mtx.Lock()
+
+	conn, ok := m.channels[channel]
+	if !ok {
+		m.mtx.Unlock()
+		return
+	}
+
+	delete(m.channels, channel)
+
+	idle := len(m.ownedBy(conn)) == 0
+	if idle {
+		m.removeConnector(conn)
+	}
+
+	m.mtx.Unlock()
+
+	// Outside the lock, as parting writes to the connection
+	conn.Part(channel)
+
+	if idle {
+		zap.S().Infow("Closing idle IRC connection")
+		conn.Disconnect()
+	}
+}
+
+type channelMove struct {
+	channel string
+	from    *IrcConnection
+	to      *IrcConnection
+}
+
+// Rebalance packs the channels into as few connections as possible and closes the ones left empty.
+//
+// A moved channel keeps being read from its old connection until the new one has joined it.
+func (m *IrcManager) Rebalance() {
+	m.mtx.Lock()
+
+	// Channels are waiting for the new connections, leave them be until they are up
+	if len(m.dialing) > 0 {
+		m.mtx.Unlock()
+		return
+	}
+
+	limit := m.channelLimit()
+	counts := m.ownedCounts()
+
+	needed := (len(m.channels) + limit - 1) / limit
+	if len(m.conns) <= needed {
+		m.mtx.Unlock()
+		return
+	}
+
+	conns := make([]*IrcConnection, len(m.conns))
+	copy(conns, m.conns)
+
+	sort.SliceStable(conns, func(i, j int) bool {
+		return counts[conns[i]] > counts[conns[j]]
+	})
+
+	keep, drain := conns[:needed], conns[needed:]
+
+	moves := make([]channelMove, 0)
+	for _, from := range drain {
+		for _, channel := range m.ownedBy(from) {
+			for _, to := range keep {
+				if counts[to] < limit {
+					counts[to]++
+					moves = append(moves, channelMove{channel, from, to})
+					break
+				}
+			}
+		}
+	}
+
+	m.mtx.Unlock()
+
+	zap.S().Infow("Rebalancing IRC connections", "connections", len(conns), "needed", needed, "moves", len(moves))
+
+	for _, move := range moves {
+		move.to.Join(move.channel)
+	}
+
+	go m.finishMoves(moves, drain)
+}
+
+func (m *IrcManager) finishMoves(moves []channelMove, drain []*IrcConnection) {
+	deadline := time.After(MOVE_JOIN_TIMEOUT)
+
+	for len(moves) > 0 {
+		pending := moves[:0]
+
+		for _, move := range moves {
+			if !move.to.IsConnectedToChannel(move.channel) {
+				pending = append(pending, move)
+				continue
+			}
+
+			m.mtx.Lock()
+			if m.channels[move.channel] == move.from {
+				m.channels[move.channel] = move.to
+			}
+			m.mtx.Unlock()
+
+			move.from.Part(move.channel)
+		}
+
+		moves = pending
+		if len(moves) == 0 {
+			break
+		}
+
+		select {
+		case <-m.ctx.Done():
 			return
+		case <-deadline:
+			zap.S().Warnw("Channels did not join their new connection in time, keeping them where they were", "channels", len(moves))
+
+			for _, move := range moves {
+				move.to.Part(move.channel)
+			}
+
+			moves = nil
+		case <-time.After(1 * time.Second):
 		}
 	}
-}
\ No newline at end of file
+
+	for _, conn := range drain {
+		m.mtx.Lock()
+		idle := len(m.ownedBy(conn)) == 0
+		if idle {
+			m.removeConnector(conn)
+		}
+		m.mtx.Unlock()
+
+		if idle {
+			zap.S().Infow("Closing idle IRC connection")
+			conn.Disconnect()
+		}
+	}
+}
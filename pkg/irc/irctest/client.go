@@ -0,0 +1,128 @@
+package irctest
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client is a connection to the Server as seen by the server.
+type Client struct {
+	Nick string
+	Pass string
+
+	conn     *websocket.Conn
+	writeMtx sync.Mutex
+
+	mtx      sync.Mutex
+	channels map[string]bool
+	received []string
+	// notify is closed and replaced whenever a line is received
+	notify chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *Client) source() string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return ":" + c.Nick + "!" + c.Nick + "@" + c.Nick + ".tmi.twitch.tv"
+}
+
+func (c *Client) record(line string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.received = append(c.received, line)
+
+	close(c.notify)
+	c.notify = make(chan struct{})
+}
+
+// Send writes a raw line to the client.
+func (c *Client) Send(line string) error {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	return c.conn.WriteMessage(websocket.TextMessage, []byte(line+"\r\n"))
+}
+
+// Privmsg sends a chat message from user in channel.
+func (c *Client) Privmsg(channel, user, message string) error {
+	return c.Send(":" + user + "!" + user + "@" + user + ".tmi.twitch.tv PRIVMSG #" + channel + " :" + message)
+}
+
+// Reconnect asks the client to reconnect, like Twitch does before a restart.
+func (c *Client) Reconnect() error {
+	return c.Send(":tmi.twitch.tv RECONNECT")
+}
+
+// Disconnect drops the connection without a word.
+func (c *Client) Disconnect() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.conn.Close()
+	})
+}
+
+// Closed is closed once the connection is gone.
+func (c *Client) Closed() <-chan struct{} {
+	return c.closed
+}
+
+// Channels returns the channels the client is in, sorted.
+func (c *Client) Channels() []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	channels := make([]string, 0, len(c.channels))
+	for channel := range c.channels {
+		channels = append(channels, channel)
+	}
+
+	sort.Strings(channels)
+
+	return channels
+}
+
+// Received returns every line the client sent.
+func (c *Client) Received() []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	received := make([]string, len(c.received))
+	copy(received, c.received)
+
+	return received
+}
+
+// WaitFor blocks until the client sent a line starting with prefix, and returns it.
+func (c *Client) WaitFor(prefix string, timeout time.Duration) (string, error) {
+	deadline := time.After(timeout)
+	seen := 0
+
+	for {
+		c.mtx.Lock()
+		received := c.received[seen:]
+		seen = len(c.received)
+		notify := c.notify
+		c.mtx.Unlock()
+
+		for _, line := range received {
+			if strings.HasPrefix(line, prefix) {
+				return line, nil
+			}
+		}
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return "", ErrTimeout
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Package irctest runs a fake Twitch IRC server in process, so clients can be tested without Twitch.
+package irctest
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrTimeout = errors.New("timed out waiting for the server")
+)
+
+// Server is a websocket IRC server which behaves like Twitch for the commands we use.
+//
+// Every field must be set before the first client connects.
+type Server struct {
+	// URL is the ws:// address clients should connect to
+	URL string
+
+	// FailLogin rejects every login like Twitch does for a bad oauth token
+	FailLogin bool
+	// IgnorePings makes the server never answer a PING
+	IgnorePings bool
+	// Suspended channels are answered with msg_channel_suspended instead of a JOIN
+	Suspended []string
+	// Handler is called for every line a client sends before the server handles it,
+	// returning true means the line was handled and the server ignores it.
+	Handler func(c *Client, line string) bool
+
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mtx       sync.Mutex
+	clients   []*Client
+	connected chan *Client
+}
+
+// NewServer starts a server on a random local port, it has to be stopped with Close.
+func NewServer() *Server {
+	s := &Server{
+		connected: make(chan *Client, 64),
+	}
+
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	s.URL = "ws" + strings.TrimPrefix(s.srv.URL, "http")
+
+	return s
+}
+
+// Listen starts a server on address, like 127.0.0.1:6680, so a client can be pointed at it by config.
+//
+// The server does not wait for WaitForClient, so it can run without a test around it.
+func Listen(address string) (*Server, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		connected: make(chan *Client, 64),
+	}
+
+	s.srv = httptest.NewUnstartedServer(http.HandlerFunc(s.serve))
+	s.srv.Listener.Close()
+	s.srv.Listener = l
+	s.srv.Start()
+	s.URL = "ws" + strings.TrimPrefix(s.srv.URL, "http")
+
+	return s, nil
+}
+
+// Close disconnects every client and stops the server.
+func (s *Server) Close() {
+	for _, c := range s.Clients() {
+		c.Disconnect()
+	}
+
+	s.srv.Close()
+}
+
+// Clients returns every client that has connected, including the ones that disconnected since.
+func (s *Server) Clients() []*Client {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	clients := make([]*Client, len(s.clients))
+	copy(clients, s.clients)
+
+	return clients
+}
+
+// WaitForClient returns the next client that logs in.
+func (s *Server) WaitForClient(timeout time.Duration) (*Client, error) {
+	select {
+	case c := <-s.connected:
+		return c, nil
+	case <-time.After(timeout):
+		return nil, ErrTimeout
+	}
+}
+
+// Broadcast sends the line to every connected client.
+func (s *Server) Broadcast(line string) {
+	for _, c := range s.Clients() {
+		c.Send(line)
+	}
+}
+
+func (s *Server) isSuspended(channel string) bool {
+	for _, suspended := range s.Suspended {
+		if suspended == channel {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	c := &Client{
+		conn:     conn,
+		channels: make(map[string]bool),
+		received: make([]string, 0),
+		notify:   make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+
+	s.mtx.Lock()
+	s.clients = append(s.clients, c)
+	s.mtx.Unlock()
+
+	defer c.Disconnect()
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		for _, line := range strings.Split(string(msg), "\r\n") {
+			if line == "" {
+				continue
+			}
+
+			c.record(line)
+
+			if s.Handler != nil && s.Handler(c, line) {
+				continue
+			}
+
+			s.handle(c, line)
+		}
+	}
+}
+
+func (s *Server) handle(c *Client, line string) {
+	command, args, _ := strings.Cut(line, " ")
+
+	switch command {
+	case "PASS":
+		{
+			c.mtx.Lock()
+			c.Pass = args
+			c.mtx.Unlock()
+		}
+	case "NICK":
+		{
+			c.mtx.Lock()
+			c.Nick = args
+			c.mtx.Unlock()
+
+			if s.FailLogin {
+				c.Send(":tmi.twitch.tv NOTICE * :Login authentication failed")
+				c.Disconnect()
+				return
+			}
+
+			c.Send(":tmi.twitch.tv 001 " + args + " :Welcome, GLHF!")
+			c.Send(":tmi.twitch.tv 376 " + args + " :>")
+
+			// Nobody waits for clients of a server started with Listen
+			select {
+			case s.connected <- c:
+			default:
+			}
+		}
+	case "CAP":
+		{
+			c.Send(":tmi.twitch.tv CAP * ACK " + strings.TrimPrefix(args, "REQ "))
+		}
+	case "PING":
+		{
+			if !s.IgnorePings {
+				c.Send(":tmi.twitch.tv PONG tmi.twitch.tv " + args)
+			}
+		}
+	case "JOIN":
+		{
+			for _, channel := range strings.Split(args, ",") {
+				channel = strings.TrimPrefix(channel, "#")
+
+				if s.isSuspended(channel) {
+					c.Send("@msg-id=msg_channel_suspended :tmi.twitch.tv NOTICE #" + channel + " :This channel does not exist or has been suspended.")
+					continue
+				}
+
+				c.mtx.Lock()
+				c.channels[channel] = true
+				c.mtx.Unlock()
+
+				c.Send(c.source() + " JOIN #" + channel)
+			}
+		}
+	case "PART":
+		{
+			channel := strings.TrimPrefix(args, "#")
+
+			c.mtx.Lock()
+			delete(c.channels, channel)
+			c.mtx.Unlock()
+
+			c.Send(c.source() + " PART #" + channel)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package irc
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// JoinResult is how Twitch answered a JOIN
+type JoinResult int
+
+const (
+	JoinSuccess = JoinResult(iota)
+	// JoinSuspended means the channel does not exist or has been suspended
+	JoinSuspended = JoinResult(iota)
+	// JoinBanned means our account is banned from the channel
+	JoinBanned = JoinResult(iota)
+	// JoinTimeout means Twitch never answered
+	JoinTimeout = JoinResult(iota)
+	// JoinFailed means the connection was lost before Twitch answered
+	JoinFailed = JoinResult(iota)
+)
+
+// joinNotices maps the msg-id of a NOTICE to the join failure it means
+var joinNotices = map[string]JoinResult{
+	"msg_channel_suspended": JoinSuspended,
+	"msg_banned":            JoinBanned,
+}
+
+func (r JoinResult) String() string {
+	switch r {
+	case JoinSuccess:
+		return "success"
+	case JoinSuspended:
+		return "suspended"
+	case JoinBanned:
+		return "banned"
+	case JoinTimeout:
+		return "timeout"
+	case JoinFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Error describes the failure, it is empty on success
+func (r JoinResult) Error() string {
+	if r == JoinSuccess {
+		return ""
+	}
+
+	return r.String()
+}
+
+// Transient reports if trying to join again later could succeed
+func (r JoinResult) Transient() bool {
+	return r == JoinTimeout || r == JoinFailed
+}
+
+type joinWaiter struct {
+	result   chan JoinResult
+	sent     chan struct{}
+	sentOnce sync.Once
+}
+
+// JoinAndWait joins the channel and waits for Twitch to confirm or reject it.
+//
+// The timeout starts once the JOIN has left the rate limit queue.
+func (c *IrcConnection) JoinAndWait(channel string, timeout time.Duration) JoinResult {
+	if channel == "" {
+		return JoinFailed
+	}
+
+	if c.IsConnectedToChannel(channel) {
+		return JoinSuccess
+	}
+
+	w := &joinWaiter{
+		result: make(chan JoinResult, 1),
+		sent:   make(chan struct{}),
+	}
+
+	c.ChannelMtx.Lock()
+	c.joinWaiters[channel] = append(c.joinWaiters[channel], w)
+	c.ChannelMtx.Unlock()
+
+	defer c.removeJoinWaiter(channel, w)
+
+	c.Join(channel)
+
+	select {
+	case <-c.closed:
+		return JoinFailed
+	case res := <-w.result:
+		return res
+	case <-w.sent:
+	}
+
+	select {
+	case <-c.closed:
+		return JoinFailed
+	case res := <-w.result:
+		return res
+	case <-time.After(timeout):
+		return JoinTimeout
+	}
+}
+
+func (c *IrcConnection) removeJoinWaiter(channel string, w *joinWaiter) {
+	c.ChannelMtx.Lock()
+	defer c.ChannelMtx.Unlock()
+
+	waiters := c.joinWaiters[channel]
+	for i, waiter := range waiters {
+		if waiter == w {
+			waiters = append(waiters[:i:i], waiters[i+1:]...)
+			break
+		}
+	}
+
+	if len(waiters) == 0 {
+		delete(c.joinWaiters, channel)
+	} else {
+		c.joinWaiters[channel] = waiters
+	}
+}
+
+// resolveJoin answers everyone waiting for the channel, c.ChannelMtx must be held
+func (c *IrcConnection) resolveJoin(channel string, res JoinResult) {
+	for _, w := range c.joinWaiters[channel] {
+		select {
+		case w.result <- res:
+		default:
+		}
+	}
+}
+
+// markJoinSent starts the timeout of everyone waiting for the JOIN in msg
+func (c *IrcConnection) markJoinSent(msg string) {
+	if !strings.HasPrefix(msg, "JOIN ") {
+		return
+	}
+
+	channel := sanitizeChannel(strings.TrimPrefix(msg, "JOIN "))
+
+	c.ChannelMtx.Lock()
+	defer c.ChannelMtx.Unlock()
+
+	for _, w := range c.joinWaiters[channel] {
+		w.sentOnce.Do(func() { close(w.sent) })
+	}
+}
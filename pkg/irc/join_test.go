@@ -0,0 +1,82 @@
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+// waitForJoinWaiter blocks until JoinAndWait has registered itself
+func waitForJoinWaiter(t *testing.T, c *IrcConnection, channel string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.ChannelMtx.Lock()
+		n := len(c.joinWaiters[channel])
+		c.ChannelMtx.Unlock()
+
+		if n > 0 {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("no one is waiting for %s", channel)
+}
+
+func TestJoinAndWait(t *testing.T) {
+	testCases := []struct {
+		Channel string
+		Line    string
+		Want    JoinResult
+	}{
+		{
+			Channel: "forsen",
+			Line:    ":justinfan123!justinfan123@justinfan123.tmi.twitch.tv JOIN #forsen",
+			Want:    JoinSuccess,
+		},
+		{
+			Channel: "suspended",
+			Line:    "@msg-id=msg_channel_suspended :tmi.twitch.tv NOTICE #suspended :This channel does not exist or has been suspended.",
+			Want:    JoinSuspended,
+		},
+		{
+			Channel: "pajlada",
+			Line:    "@msg-id=msg_banned :tmi.twitch.tv NOTICE #pajlada :You are permanently banned from talking in pajlada.",
+			Want:    JoinBanned,
+		},
+	}
+
+	for _, testCase := range testCases {
+		c := NewClient(DEFAULT_USERNAME, DEFAULT_PASSWORD)
+
+		got := make(chan JoinResult)
+		go func(channel string) {
+			got <- c.JoinAndWait(channel, time.Second)
+		}(testCase.Channel)
+
+		waitForJoinWaiter(t, c, testCase.Channel)
+		c.handleLine(testCase.Line)
+
+		if res := <-got; res != testCase.Want {
+			t.Errorf("%s: got %s, want %s", testCase.Channel, res, testCase.Want)
+		}
+	}
+}
+
+func TestJoinAndWaitTimeout(t *testing.T) {
+	c := NewClient(DEFAULT_USERNAME, DEFAULT_PASSWORD)
+
+	got := make(chan JoinResult)
+	go func() {
+		got <- c.JoinAndWait("forsen", 10*time.Millisecond)
+	}()
+
+	waitForJoinWaiter(t, c, "forsen")
+	c.markJoinSent("JOIN #forsen")
+
+	if res := <-got; res != JoinTimeout {
+		t.Errorf("got %s, want %s", res, JoinTimeout)
+	}
+}
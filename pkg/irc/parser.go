@@ -1,7 +1,14 @@
 package irc
 
 import (
+	"errors"
+	"strconv"
 	"strings"
+	"time"
+)
+
+var (
+	ErrMalformedLine = errors.New("malformed irc line")
 )
 
 type ircMessage struct {
@@ -32,11 +39,15 @@ func ParseLine(line string) (Message, error) {
 		idx++
 	}
 
-	if strings.HasPrefix(split[idx], ":") {
+	if idx < len(split) && strings.HasPrefix(split[idx], ":") {
 		m.Source = parseSource(split[idx])
 		idx++
 	}
 
+	if idx >= len(split) {
+		return nil, ErrMalformedLine
+	}
+
 	m.Command = split[idx]
 	idx++
 
@@ -50,6 +61,10 @@ func ParseLine(line string) (Message, error) {
 		idx++
 	}
 
+	if len(m.Params) < minParams[m.Command] {
+		return nil, ErrMalformedLine
+	}
+
 	switch m.Command {
 	case "376":
 		{
@@ -83,6 +98,34 @@ func ParseLine(line string) (Message, error) {
 		{
 			return parsePart(m), nil
 		}
+	case "USERNOTICE":
+		{
+			return parseUserNotice(&m), nil
+		}
+	case "CLEARCHAT":
+		{
+			return parseClearChat(&m), nil
+		}
+	case "CLEARMSG":
+		{
+			return parseClearMsg(&m), nil
+		}
+	case "ROOMSTATE":
+		{
+			return parseRoomState(&m), nil
+		}
+	case "USERSTATE":
+		{
+			return parseUserState(&m), nil
+		}
+	case "GLOBALUSERSTATE":
+		{
+			return parseGlobalUserState(&m), nil
+		}
+	case "WHISPER":
+		{
+			return parseWhisper(&m), nil
+		}
 	default:
 		{
 			return &RawMessage{
@@ -93,6 +136,22 @@ func ParseLine(line string) (Message, error) {
 	}
 }
 
+// minParams is the amount of parameters a command needs before it can be parsed
+var minParams = map[string]int{
+	"376":     2,
+	"NOTICE":  2,
+	"PRIVMSG": 2,
+	"JOIN":    1,
+	"PART":    1,
+
+	"USERNOTICE": 1,
+	"CLEARCHAT":  1,
+	"CLEARMSG":   1,
+	"ROOMSTATE":  1,
+	"USERSTATE":  1,
+	"WHISPER":    2,
+}
+
 func sanitizeChannel(channel string) string {
 	return strings.Replace(channel, "#", "", 1)
 }
@@ -109,7 +168,10 @@ func parseSource(source string) ircMessageSource {
 	if len(split) > 1 {
 		split = strings.Split(split[1], "@")
 		s.User = split[0]
-		s.Host = split[1]
+
+		if len(split) > 1 {
+			s.Host = split[1]
+		}
 	}
 
 	return s
@@ -196,17 +258,108 @@ func parsePart(m ircMessage) *PartMessage {
 	}
 }
 
-func parseTags(tags string) Tags {
-	tags = strings.TrimPrefix(tags, "@")
+// trailing returns the parameter at idx or an empty string when it is not present
+func (m *ircMessage) trailing(idx int) string {
+	if len(m.Params) > idx {
+		return m.Params[idx]
+	}
+
+	return ""
+}
+
+func (m *ircMessage) tags() Tags {
+	if m.Tags == nil {
+		return Tags{}
+	}
 
-	split := strings.Split(tags, ";")
+	return m.Tags
+}
 
-	t := make(Tags, len(split))
+func parseUserNotice(m *ircMessage) *UserNoticeMessage {
+	tags := m.tags()
+	params := Tags{}
 
-	for _, tag := range split {
-		split := strings.Split(tag, "=")
-		t[split[0]] = split[1]
+	for k, v := range tags {
+		if strings.HasPrefix(k, "msg-param-") {
+			params[strings.TrimPrefix(k, "msg-param-")] = v
+		}
 	}
 
-	return t
+	return &UserNoticeMessage{
+		Raw:       m.Raw,
+		Channel:   sanitizeChannel(m.Params[0]),
+		User:      tags["login"],
+		Message:   m.trailing(1),
+		MsgID:     tags["msg-id"],
+		SystemMsg: tags["system-msg"],
+		MsgParams: params,
+		Tags:      tags,
+	}
+}
+
+func parseClearChat(m *ircMessage) *ClearChatMessage {
+	tags := m.tags()
+
+	msg := &ClearChatMessage{
+		Raw:          m.Raw,
+		Channel:      sanitizeChannel(m.Params[0]),
+		TargetUser:   m.trailing(1),
+		TargetUserID: tags["target-user-id"],
+		Tags:         tags,
+	}
+
+	if seconds, err := strconv.Atoi(tags["ban-duration"]); err == nil {
+		msg.BanDuration = time.Duration(seconds) * time.Second
+	}
+
+	return msg
+}
+
+func parseClearMsg(m *ircMessage) *ClearMsgMessage {
+	tags := m.tags()
+
+	return &ClearMsgMessage{
+		Raw:         m.Raw,
+		Channel:     sanitizeChannel(m.Params[0]),
+		User:        tags["login"],
+		TargetMsgID: tags["target-msg-id"],
+		Message:     m.trailing(1),
+		Tags:        tags,
+	}
+}
+
+func parseRoomState(m *ircMessage) *RoomStateMessage {
+	tags := m.tags()
+
+	return &RoomStateMessage{
+		Raw:     m.Raw,
+		Channel: sanitizeChannel(m.Params[0]),
+		RoomID:  tags["room-id"],
+		Tags:    tags,
+	}
+}
+
+func parseUserState(m *ircMessage) *UserStateMessage {
+	return &UserStateMessage{
+		Raw:     m.Raw,
+		Channel: sanitizeChannel(m.Params[0]),
+		Tags:    m.tags(),
+	}
+}
+
+func parseGlobalUserState(m *ircMessage) *GlobalUserStateMessage {
+	return &GlobalUserStateMessage{
+		Raw:  m.Raw,
+		Tags: m.tags(),
+	}
+}
+
+func parseWhisper(m *ircMessage) *WhisperMessage {
+	return &WhisperMessage{
+		Raw:     m.Raw,
+		User:    m.Source.Nick,
+		Target:  m.Params[0],
+		Message: m.Params[1],
+		Tags:    m.tags(),
+	}
 }
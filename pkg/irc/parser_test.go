@@ -1,6 +1,9 @@
 package irc
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestCanParsePING(t *testing.T) {
 	type testT struct {
@@ -366,3 +369,252 @@ func assertEqual(t *testing.T, lhs, rhs string) {
 		t.Errorf("got %v, want %v", lhs, rhs)
 	}
 }
+
+func TestParseUserNotice(t *testing.T) {
+	line := `@badge-info=;badges=;color=#0000FF;display-name=Forsen;emotes=;flags=;id=3d830f12-795c-447d-af3c-ea05e40fbddb;login=forsen;mod=0;msg-id=raid;msg-param-displayName=Forsen;msg-param-login=forsen;msg-param-viewerCount=9000;room-id=84180052;subscriber=0;system-msg=9000\sraiders\sfrom\sForsen\shave\sjoined!;tmi-sent-ts=1507246572675;user-id=22484632;user-type= :tmi.twitch.tv USERNOTICE #brian6932`
+
+	got, err := ParseLine(line)
+	if err != nil {
+		t.Fatalf("ParseLine threw an error -- %v", err)
+	}
+	msg := got.(*UserNoticeMessage)
+
+	if msg.GetType() != USERNOTICE {
+		t.Errorf("got %v, want %v", msg.GetType(), USERNOTICE)
+	}
+
+	assertEqual(t, msg.Channel, "brian6932")
+	assertEqual(t, msg.User, "forsen")
+	assertEqual(t, msg.UserID(), "22484632")
+	assertEqual(t, msg.MsgID, "raid")
+	assertEqual(t, msg.Message, "")
+	assertEqual(t, msg.SystemMsg, "9000 raiders from Forsen have joined!")
+	assertEqual(t, msg.MsgParams["viewerCount"], "9000")
+
+	got, err = ParseLine(`@login=markzynk;msg-id=resub;msg-param-cumulative-months=17;system-msg=xD;user-id=88492428 :tmi.twitch.tv USERNOTICE #forsen :AlienPls`)
+	if err != nil {
+		t.Fatalf("ParseLine threw an error -- %v", err)
+	}
+	msg = got.(*UserNoticeMessage)
+
+	assertEqual(t, msg.MsgID, "resub")
+	assertEqual(t, msg.Message, "AlienPls")
+	assertEqual(t, msg.MsgParams["cumulative-months"], "17")
+}
+
+func TestParseClearChat(t *testing.T) {
+	testCases := []struct {
+		Line      string
+		Target    string
+		Duration  time.Duration
+		FullClear bool
+		Ban       bool
+		Timeout   bool
+	}{
+		{
+			Line:      "@room-id=22484632;tmi-sent-ts=1642715695392 :tmi.twitch.tv CLEARCHAT #forsen",
+			FullClear: true,
+		},
+		{
+			Line:   "@room-id=22484632;target-user-id=88492428;tmi-sent-ts=1642715756806 :tmi.twitch.tv CLEARCHAT #forsen :markzynk",
+			Target: "markzynk",
+			Ban:    true,
+		},
+		{
+			Line:     "@ban-duration=600;room-id=22484632;target-user-id=88492428;tmi-sent-ts=1642719320727 :tmi.twitch.tv CLEARCHAT #forsen :markzynk",
+			Target:   "markzynk",
+			Duration: 10 * time.Minute,
+			Timeout:  true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		got, err := ParseLine(testCase.Line)
+		if err != nil {
+			t.Fatalf("ParseLine threw an error -- %v", err)
+		}
+		msg := got.(*ClearChatMessage)
+
+		assertEqual(t, msg.Channel, "forsen")
+		assertEqual(t, msg.TargetUser, testCase.Target)
+
+		if msg.BanDuration != testCase.Duration {
+			t.Errorf("got %v, want %v", msg.BanDuration, testCase.Duration)
+		}
+
+		if msg.IsFullClear() != testCase.FullClear || msg.IsBan() != testCase.Ban || msg.IsTimeout() != testCase.Timeout {
+			t.Errorf("%s: wrong kind of clear", testCase.Line)
+		}
+	}
+}
+
+func TestParseClearMsg(t *testing.T) {
+	line := "@login=markzynk;room-id=;target-msg-id=c98dc399-5e46-4727-b1fa-730b7c522c7c;tmi-sent-ts=1642720582342 :tmi.twitch.tv CLEARMSG #forsen :AlienPls"
+
+	got, err := ParseLine(line)
+	if err != nil {
+		t.Fatalf("ParseLine threw an error -- %v", err)
+	}
+	msg := got.(*ClearMsgMessage)
+
+	if msg.GetType() != CLEARMSG {
+		t.Errorf("got %v, want %v", msg.GetType(), CLEARMSG)
+	}
+
+	assertEqual(t, msg.Channel, "forsen")
+	assertEqual(t, msg.User, "markzynk")
+	assertEqual(t, msg.TargetMsgID, "c98dc399-5e46-4727-b1fa-730b7c522c7c")
+	assertEqual(t, msg.Message, "AlienPls")
+}
+
+func TestParseRoomState(t *testing.T) {
+	got, err := ParseLine("@emote-only=0;followers-only=-1;r9k=0;room-id=22484632;slow=30;subs-only=1 :tmi.twitch.tv ROOMSTATE #forsen")
+	if err != nil {
+		t.Fatalf("ParseLine threw an error -- %v", err)
+	}
+	msg := got.(*RoomStateMessage)
+
+	assertEqual(t, msg.Channel, "forsen")
+	assertEqual(t, msg.RoomID, "22484632")
+
+	if v, ok := msg.EmoteOnly(); v || !ok {
+		t.Errorf("emote-only: got %v %v, want false true", v, ok)
+	}
+
+	if v, ok := msg.SubsOnly(); !v || !ok {
+		t.Errorf("subs-only: got %v %v, want true true", v, ok)
+	}
+
+	if v, ok := msg.Slow(); v != 30*time.Second || !ok {
+		t.Errorf("slow: got %v %v, want 30s true", v, ok)
+	}
+
+	if v, ok := msg.FollowersOnly(); v >= 0 || !ok {
+		t.Errorf("followers-only: got %v %v, want disabled", v, ok)
+	}
+
+	got, err = ParseLine("@emote-only=1;room-id=22484632 :tmi.twitch.tv ROOMSTATE #forsen")
+	if err != nil {
+		t.Fatalf("ParseLine threw an error -- %v", err)
+	}
+	msg = got.(*RoomStateMessage)
+
+	if v, ok := msg.EmoteOnly(); !v || !ok {
+		t.Errorf("emote-only: got %v %v, want true true", v, ok)
+	}
+
+	if _, ok := msg.Slow(); ok {
+		t.Errorf("slow: got a value for a partial update")
+	}
+}
+
+func TestParseUserState(t *testing.T) {
+	testCases := []struct {
+		Line      string
+		Moderator bool
+	}{
+		{"@badge-info=;badges=;color=#FF0000;display-name=melon095;emote-sets=0;mod=0;subscriber=0;user-type= :tmi.twitch.tv USERSTATE #forsen", false},
+		{"@badge-info=;badges=moderator/1;color=#FF0000;display-name=melon095;emote-sets=0;mod=1;subscriber=0;user-type=mod :tmi.twitch.tv USERSTATE #forsen", true},
+		{"@badge-info=;badges=broadcaster/1;color=#FF0000;display-name=melon095;emote-sets=0;mod=0;subscriber=0;user-type= :tmi.twitch.tv USERSTATE #melon095", true},
+	}
+
+	for _, testCase := range testCases {
+		got, err := ParseLine(testCase.Line)
+		if err != nil {
+			t.Fatalf("ParseLine threw an error -- %v", err)
+		}
+		msg := got.(*UserStateMessage)
+
+		if msg.IsModerator() != testCase.Moderator {
+			t.Errorf("%s: got %v, want %v", testCase.Line, msg.IsModerator(), testCase.Moderator)
+		}
+	}
+}
+
+func TestParseGlobalUserState(t *testing.T) {
+	got, err := ParseLine("@badge-info=;badges=;color=#FF0000;display-name=melon095;emote-sets=0;user-id=146910710;user-type= :tmi.twitch.tv GLOBALUSERSTATE")
+	if err != nil {
+		t.Fatalf("ParseLine threw an error -- %v", err)
+	}
+	msg := got.(*GlobalUserStateMessage)
+
+	assertEqual(t, msg.UserID(), "146910710")
+	assertEqual(t, msg.DisplayName(), "melon095")
+}
+
+func TestParseWhisper(t *testing.T) {
+	got, err := ParseLine("@badges=;color=;display-name=MarkZynk;emotes=;message-id=1;thread-id=88492428_146910710;turbo=0;user-id=88492428;user-type= :markzynk!markzynk@markzynk.tmi.twitch.tv WHISPER melon095 :hello there")
+	if err != nil {
+		t.Fatalf("ParseLine threw an error -- %v", err)
+	}
+	msg := got.(*WhisperMessage)
+
+	assertEqual(t, msg.User, "markzynk")
+	assertEqual(t, msg.Target, "melon095")
+	assertEqual(t, msg.Message, "hello there")
+	assertEqual(t, msg.UserID(), "88492428")
+}
+
+func TestPrivmsgAccessors(t *testing.T) {
+	line := `@badge-info=subscriber/17;badges=moderator/1,subscriber/12;bits=100;color=#FFFBFF;display-name=MarkZynk;emotes=25:0-4;first-msg=1;id=c98dc399-5e46-4727-b1fa-730b7c522c7c;mod=1;reply-parent-display-name=Forsen;reply-parent-msg-body=hello\sthere;reply-parent-msg-id=b34ccfc7-4977-403a-8a94-33c6bac34fb8;reply-parent-user-id=22484632;reply-parent-user-login=forsen;room-id=22484632;subscriber=1;tmi-sent-ts=1666921002844;user-id=88492428 :markzynk!markzynk@markzynk.tmi.twitch.tv PRIVMSG #forsen :Kappa cheer100`
+
+	got, err := ParseLine(line)
+	if err != nil {
+		t.Fatalf("ParseLine threw an error -- %v", err)
+	}
+	msg := got.(*PrivmsgMessage)
+
+	assertEqual(t, msg.ID(), "c98dc399-5e46-4727-b1fa-730b7c522c7c")
+	assertEqual(t, msg.RoomID(), "22484632")
+	assertEqual(t, msg.DisplayName(), "MarkZynk")
+	assertEqual(t, msg.Color(), "#FFFBFF")
+
+	if !msg.Timestamp().Equal(time.UnixMilli(1666921002844)) {
+		t.Errorf("got %v, want %v", msg.Timestamp(), time.UnixMilli(1666921002844))
+	}
+
+	if msg.Bits() != 100 {
+		t.Errorf("got %d bits, want 100", msg.Bits())
+	}
+
+	if !msg.IsFirstMessage() || !msg.IsModerator() || !msg.IsSubscriber() || msg.IsVIP() || msg.IsBroadcaster() {
+		t.Errorf("got wrong roles")
+	}
+
+	if msg.SubscriberMonths() != 17 {
+		t.Errorf("got %d months, want 17", msg.SubscriberMonths())
+	}
+
+	if badges := msg.Badges(); len(badges) != 2 || badges[1] != (Badge{Name: "subscriber", Version: "12"}) {
+		t.Errorf("got %v, want moderator and subscriber badges", badges)
+	}
+
+	if emotes := msg.Emotes(); len(emotes) != 1 || emotes[0].Name != "Kappa" {
+		t.Errorf("got %v, want Kappa", emotes)
+	}
+
+	parent, ok := msg.ReplyParent()
+	if !ok {
+		t.Fatalf("got no reply parent")
+	}
+
+	assertEqual(t, parent.MsgID, "b34ccfc7-4977-403a-8a94-33c6bac34fb8")
+	assertEqual(t, parent.UserID, "22484632")
+	assertEqual(t, parent.UserLogin, "forsen")
+	assertEqual(t, parent.DisplayName, "Forsen")
+	assertEqual(t, parent.Body, "hello there")
+
+	got, err = ParseLine(":markzynk!markzynk@markzynk.tmi.twitch.tv PRIVMSG #forsen :AlienPls")
+	if err != nil {
+		t.Fatalf("ParseLine threw an error -- %v", err)
+	}
+	msg = got.(*PrivmsgMessage)
+
+	if !msg.Timestamp().IsZero() || msg.Bits() != 0 || len(msg.Emotes()) != 0 || len(msg.Badges()) != 0 {
+		t.Errorf("got values for a message without tags")
+	}
+
+	if _, ok := msg.ReplyParent(); ok {
+		t.Errorf("got a reply parent for a message without tags")
+	}
+}
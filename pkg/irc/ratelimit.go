@@ -0,0 +1,277 @@
+package irc
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RateLimit is a budget of Count commands every Period.
+type RateLimit struct {
+	Count  int
+	Period time.Duration
+}
+
+// https://dev.twitch.tv/docs/irc/#rate-limits
+var (
+	// JoinLimitAnonymous applies to anonymous and regular accounts
+	JoinLimitAnonymous = RateLimit{Count: 20, Period: 10 * time.Second}
+	// JoinLimitVerified applies to verified bots
+	JoinLimitVerified = RateLimit{Count: 2000, Period: 10 * time.Second}
+	// MessageLimitNormal applies to channels where we are a regular chatter
+	MessageLimitNormal = RateLimit{Count: 20, Period: 30 * time.Second}
+	// MessageLimitModerator applies to channels where we are moderator or broadcaster
+	MessageLimitModerator = RateLimit{Count: 100, Period: 30 * time.Second}
+)
+
+// bucket is a token bucket which starts full and refills continuously.
+type bucket struct {
+	mtx    sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(limit RateLimit) *bucket {
+	return &bucket{
+		limit:  limit,
+		tokens: float64(limit.Count),
+		last:   time.Now(),
+	}
+}
+
+func (b *bucket) setLimit(limit RateLimit) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.limit = limit
+
+	if b.tokens > float64(limit.Count) {
+		b.tokens = float64(limit.Count)
+	}
+}
+
+// take consumes a token, if none are available it returns how long to wait before trying again.
+func (b *bucket) take() time.Duration {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := time.Now()
+	perToken := b.limit.Period / time.Duration(b.limit.Count)
+
+	b.tokens += float64(now.Sub(b.last)) / float64(perToken)
+	if b.tokens > float64(b.limit.Count) {
+		b.tokens = float64(b.limit.Count)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) * float64(perToken))
+}
+
+// rateLimits are the buckets of an account, Twitch counts the commands of all its connections together
+type rateLimits struct {
+	join      *bucket
+	message   *bucket
+	moderator *bucket
+}
+
+func newRateLimits(join RateLimit) *rateLimits {
+	return &rateLimits{
+		join:      newBucket(join),
+		message:   newBucket(MessageLimitNormal),
+		moderator: newBucket(MessageLimitModerator),
+	}
+}
+
+// sendQueue holds commands waiting for their bucket, they are sent in order.
+//
+// The bucket can be shared with the queues of other connections, the queue only keeps the order.
+type sendQueue struct {
+	bucket *bucket
+	mtx    sync.Mutex
+	items  []string
+	notify chan struct{}
+}
+
+func newSendQueue(b *bucket) *sendQueue {
+	return &sendQueue{
+		bucket: b,
+		items:  make([]string, 0),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (q *sendQueue) push(msg string) {
+	q.mtx.Lock()
+	q.items = append(q.items, msg)
+	q.mtx.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *sendQueue) pop() (string, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if len(q.items) == 0 {
+		return "", false
+	}
+
+	msg := q.items[0]
+	q.items = q.items[1:]
+
+	return msg, true
+}
+
+func (q *sendQueue) len() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	return len(q.items)
+}
+
+// run writes queued commands to the connection while respecting the bucket.
+//
+// Nothing is written while the connection is not ready, so commands queued
+// during a reconnect are sent once the new socket has been accepted.
+func (q *sendQueue) run(c *IrcConnection) {
+	for {
+		msg, ok := q.pop()
+		if !ok {
+			select {
+			case <-c.closed:
+				return
+			case <-q.notify:
+				continue
+			}
+		}
+
+		for {
+			select {
+			case <-c.closed:
+				return
+			case <-c.ready():
+			}
+
+			wait := q.bucket.take()
+			if wait == 0 {
+				break
+			}
+
+			select {
+			case <-c.closed:
+				return
+			case <-time.After(wait):
+			}
+		}
+
+		c.write(msg)
+	}
+}
+
+// sendScheduler routes rate limited commands to their queue
+type sendScheduler struct {
+	join      *sendQueue
+	message   *sendQueue
+	moderator *sendQueue
+
+	modMtx     sync.Mutex
+	moderating map[string]bool
+
+	startOnce sync.Once
+}
+
+func newSendScheduler(limits *rateLimits) *sendScheduler {
+	return &sendScheduler{
+		join:       newSendQueue(limits.join),
+		message:    newSendQueue(limits.message),
+		moderator:  newSendQueue(limits.moderator),
+		moderating: make(map[string]bool),
+	}
+}
+
+func (s *sendScheduler) start(c *IrcConnection) {
+	s.startOnce.Do(func() {
+		go s.join.run(c)
+		go s.message.run(c)
+		go s.moderator.run(c)
+	})
+}
+
+// queueFor returns the queue the command belongs to, or nil if it is not rate limited.
+func (s *sendScheduler) queueFor(msg string) *sendQueue {
+	if strings.HasPrefix(msg, "@") {
+		if i := strings.IndexByte(msg, ' '); i != -1 {
+			msg = msg[i+1:]
+		}
+	}
+
+	split := strings.SplitN(msg, " ", 3)
+
+	switch strings.ToUpper(split[0]) {
+	case "JOIN":
+		return s.join
+	case "PRIVMSG":
+		{
+			if len(split) > 1 && s.isModerator(sanitizeChannel(split[1])) {
+				return s.moderator
+			}
+
+			return s.message
+		}
+	default:
+		return nil
+	}
+}
+
+func (s *sendScheduler) isModerator(channel string) bool {
+	s.modMtx.Lock()
+	defer s.modMtx.Unlock()
+
+	return s.moderating[channel]
+}
+
+func (s *sendScheduler) setModerator(channel string, moderator bool) {
+	s.modMtx.Lock()
+	defer s.modMtx.Unlock()
+
+	if moderator {
+		s.moderating[channel] = true
+	} else {
+		delete(s.moderating, channel)
+	}
+}
+
+func (s *sendScheduler) depth() int {
+	return s.join.len() + s.message.len() + s.moderator.len()
+}
+
+// SetJoinLimit changes the JOIN budget, pick JoinLimitVerified for verified bots.
+//
+// Connections of an IrcManager share their budgets, so this changes it for all of them.
+func (c *IrcConnection) SetJoinLimit(limit RateLimit) {
+	c.scheduler.join.bucket.setLimit(limit)
+}
+
+// SetModerator tells the connection that we are (or no longer are) a moderator in channel,
+// which gives PRIVMSGs to that channel the larger moderator budget.
+func (c *IrcConnection) SetModerator(channel string, moderator bool) {
+	zap.S().Debugw("Changed moderator status", "channel", channel, "moderator", moderator)
+
+	c.scheduler.setModerator(channel, moderator)
+}
+
+// QueueDepth returns the amount of commands waiting for their rate limit.
+func (c *IrcConnection) QueueDepth() int {
+	return c.scheduler.depth()
+}
@@ -0,0 +1,99 @@
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketTake(t *testing.T) {
+	b := newBucket(RateLimit{Count: 3, Period: 30 * time.Second})
+
+	for i := 0; i < 3; i++ {
+		if wait := b.take(); wait != 0 {
+			t.Fatalf("token %d: got wait %v, want 0", i, wait)
+		}
+	}
+
+	wait := b.take()
+	if wait <= 0 || wait > 10*time.Second {
+		t.Errorf("got wait %v, want between 0 and 10s", wait)
+	}
+}
+
+func TestBucketSetLimit(t *testing.T) {
+	b := newBucket(JoinLimitVerified)
+	b.setLimit(RateLimit{Count: 1, Period: time.Minute})
+
+	if wait := b.take(); wait != 0 {
+		t.Fatalf("got wait %v, want 0", wait)
+	}
+
+	if wait := b.take(); wait == 0 {
+		t.Errorf("got no wait, want the lowered limit to apply")
+	}
+}
+
+func TestSchedulerQueueFor(t *testing.T) {
+	s := newSendScheduler(newRateLimits(JoinLimitAnonymous))
+	s.setModerator("forsen", true)
+
+	testCases := []struct {
+		msg  string
+		want *sendQueue
+	}{
+		{"JOIN #forsen", s.join},
+		{"PRIVMSG #forsen :xD", s.moderator},
+		{"PRIVMSG #pajlada :xD", s.message},
+		{"@reply-parent-msg-id=123 PRIVMSG #pajlada :xD", s.message},
+		{"PART #forsen", nil},
+		{"PING : HI-:D", nil},
+		{"PASS oauth:xD", nil},
+	}
+
+	for _, testCase := range testCases {
+		if got := s.queueFor(testCase.msg); got != testCase.want {
+			t.Errorf("%s: got wrong queue", testCase.msg)
+		}
+	}
+
+	s.setModerator("forsen", false)
+
+	if got := s.queueFor("PRIVMSG #forsen :xD"); got != s.message {
+		t.Errorf("got moderator queue after losing moderator")
+	}
+}
+
+func TestSchedulersShareLimits(t *testing.T) {
+	limits := newRateLimits(RateLimit{Count: 1, Period: time.Minute})
+	a, b := newSendScheduler(limits), newSendScheduler(limits)
+
+	if wait := a.join.bucket.take(); wait != 0 {
+		t.Fatalf("got wait %v, want 0", wait)
+	}
+
+	if wait := b.join.bucket.take(); wait == 0 {
+		t.Errorf("got no wait, want the other connection to have used the budget")
+	}
+}
+
+func TestSendQueueDepth(t *testing.T) {
+	c := NewClient(DEFAULT_USERNAME, DEFAULT_PASSWORD)
+
+	c.Join("forsen")
+	c.Join("pajlada")
+	c.Send("PRIVMSG #forsen :xD")
+
+	if got := c.QueueDepth(); got != 3 {
+		t.Errorf("got %d, want 3", got)
+	}
+}
+
+func TestUserStateSetsModerator(t *testing.T) {
+	c := NewClient(DEFAULT_USERNAME, DEFAULT_PASSWORD)
+
+	c.handleLine("@badges=moderator/1;mod=1 :tmi.twitch.tv USERSTATE #forsen")
+
+	if !c.scheduler.isModerator("forsen") {
+		t.Errorf("got regular user, want moderator after USERSTATE")
+	}
+}
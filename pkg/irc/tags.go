@@ -0,0 +1,120 @@
+package irc
+
+import (
+	"sort"
+	"strings"
+)
+
+// https://ircv3.net/specs/extensions/message-tags#escaping-values
+var (
+	tagEscaper = strings.NewReplacer(
+		"\\", "\\\\",
+		";", "\\:",
+		" ", "\\s",
+		"\r", "\\r",
+		"\n", "\\n",
+	)
+)
+
+// parseTags parses the tag section of a line, with or without the leading @.
+//
+// Tags without a value are stored as an empty string and escaped values are unescaped.
+// When a key is repeated the last one wins.
+func parseTags(tags string) Tags {
+	tags = strings.TrimPrefix(tags, "@")
+
+	split := strings.Split(tags, ";")
+
+	t := make(Tags, len(split))
+
+	for _, tag := range split {
+		if tag == "" {
+			continue
+		}
+
+		key, value, _ := strings.Cut(tag, "=")
+		if key == "" {
+			continue
+		}
+
+		t[key] = unescapeTagValue(value)
+	}
+
+	return t
+}
+
+func unescapeTagValue(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+
+	var b strings.Builder
+	b.Grow(len(value))
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+
+		i++
+		if i == len(value) {
+			// A trailing lone backslash is dropped
+			break
+		}
+
+		switch value[i] {
+		case ':':
+			b.WriteByte(';')
+		case 's':
+			b.WriteByte(' ')
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			// This includes \\, anything else that is escaped is itself
+			b.WriteByte(value[i])
+		}
+	}
+
+	return b.String()
+}
+
+func escapeTagValue(value string) string {
+	return tagEscaper.Replace(value)
+}
+
+// String serializes the tags into the form used on the wire, including the leading @.
+//
+// Keys are sorted so the output is stable, empty tags return an empty string.
+func (t Tags) String() string {
+	if len(t) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('@')
+
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+
+		b.WriteString(k)
+
+		if v := t[k]; v != "" {
+			b.WriteByte('=')
+			b.WriteString(escapeTagValue(v))
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package irc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTagsEscaping(t *testing.T) {
+	testCases := []struct {
+		Line string
+		Want Tags
+	}{
+		{
+			Line: `@display-name=Foo\sBar;system-msg=5\sraiders\sfrom\sforsen\shave\sjoined!`,
+			Want: Tags{
+				"display-name": "Foo Bar",
+				"system-msg":   "5 raiders from forsen have joined!",
+			},
+		},
+		{
+			Line: `@reply-parent-msg-body=a\:b\\c\rd\ne`,
+			Want: Tags{
+				"reply-parent-msg-body": "a;b\\c\rd\ne",
+			},
+		},
+		{
+			Line: `@unknown=\x\;trailing=abc\`,
+			Want: Tags{
+				"unknown":  "x",
+				"trailing": "abc",
+			},
+		},
+		{
+			Line: "@emote-only;slow=10;;=nokey;dup=1;dup=2",
+			Want: Tags{
+				"emote-only": "",
+				"slow":       "10",
+				"dup":        "2",
+			},
+		},
+		{
+			Line: "@+client-nonce=abc;twitch.tv/vendor=1",
+			Want: Tags{
+				"+client-nonce":    "abc",
+				"twitch.tv/vendor": "1",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		got := parseTags(testCase.Line)
+
+		if len(got) != len(testCase.Want) {
+			t.Errorf("%s: got %d tags, want %d", testCase.Line, len(got), len(testCase.Want))
+		}
+
+		for k, v := range testCase.Want {
+			assertEqual(t, got[k], v)
+		}
+	}
+}
+
+func TestTagsString(t *testing.T) {
+	testCases := []struct {
+		Tags Tags
+		Want string
+	}{
+		{
+			Tags: Tags{},
+			Want: "",
+		},
+		{
+			Tags: Tags{"reply-parent-msg-id": "b34ccfc7-4977-403a-8a94-33c6bac34fb8"},
+			Want: "@reply-parent-msg-id=b34ccfc7-4977-403a-8a94-33c6bac34fb8",
+		},
+		{
+			Tags: Tags{"b": "x y;z\\", "a": "", "+c": "\r\n"},
+			Want: `@+c=\r\n;a;b=x\sy\:z\\`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		assertEqual(t, testCase.Tags.String(), testCase.Want)
+	}
+}
+
+func TestCanParseLineWithoutPanic(t *testing.T) {
+	testCases := []string{
+		"@a=b",
+		"@a=b :source",
+		":source",
+		"PRIVMSG",
+		"PRIVMSG #forsen",
+		":foo!bar PRIVMSG #forsen :xD",
+		"JOIN",
+		"376 foo",
+	}
+
+	for _, testCase := range testCases {
+		_, _ = ParseLine(testCase)
+	}
+}
+
+func FuzzParseTags(f *testing.F) {
+	f.Add("@badge-info=;badges=vip/1;color=#FF0000;display-name=melon095;emotes=;first-msg=0")
+	f.Add(`@system-msg=a\sb\:c\\d\re\nf;emote-only;x=\`)
+	f.Add("@;;=;a==b")
+
+	f.Fuzz(func(t *testing.T, line string) {
+		tags := parseTags(line)
+
+		for k := range tags {
+			// Keys are not escaped on the wire, those with separators can never round trip
+			if strings.ContainsAny(k, " ") {
+				return
+			}
+		}
+
+		again := parseTags(tags.String())
+
+		if len(again) != len(tags) {
+			t.Fatalf("round trip of %q: got %d tags, want %d", line, len(again), len(tags))
+		}
+
+		for k, v := range tags {
+			if again[k] != v {
+				t.Fatalf("round trip of %q: key %q got %q, want %q", line, k, again[k], v)
+			}
+		}
+	})
+}
+
+func FuzzParseLine(f *testing.F) {
+	f.Add("@badge-info=subscriber/17;badges=subscriber/12 :markzynk!markzynk@markzynk.tmi.twitch.tv PRIVMSG #forsen :AlienPls")
+	f.Add(":tmi.twitch.tv PONG tmi.twitch.tv :HI-:D")
+	f.Add(":tmi.twitch.tv 376 foobar :>")
+	f.Add("@msg-id=msg_channel_suspended :tmi.twitch.tv NOTICE #forsen :This channel does not exist or has been suspended.")
+
+	f.Fuzz(func(t *testing.T, line string) {
+		msg, err := ParseLine(line)
+		if err == nil && msg == nil {
+			t.Fatalf("ParseLine(%q) returned neither a message nor an error", line)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tier is the kind of account a connection logs in with, it decides how fast we may join channels.
+type Tier int
+
+const (
+	// TierAnonymous is a justinfan connection, it can only read
+	TierAnonymous = Tier(iota)
+	// TierNormal is a regular account
+	TierNormal = Tier(iota)
+	// TierKnown is an account with the known bot status
+	TierKnown = Tier(iota)
+	// TierVerified is an account with the verified bot status
+	TierVerified = Tier(iota)
+)
+
+var (
+	// JoinLimitKnown applies to known bots. Twitch no longer documents a limit for them,
+	// so it is the regular limit, ManagerOptions.JoinLimit raises it for an account known to allow more
+	JoinLimitKnown = JoinLimitAnonymous
+)
+
+func ParseTier(tier string) (Tier, error) {
+	switch strings.ToLower(tier) {
+	case "", "anonymous":
+		return TierAnonymous, nil
+	case "normal":
+		return TierNormal, nil
+	case "known":
+		return TierKnown, nil
+	case "verified":
+		return TierVerified, nil
+	default:
+		return TierAnonymous, fmt.Errorf("unknown tier %s", tier)
+	}
+}
+
+func (t Tier) String() string {
+	switch t {
+	case TierAnonymous:
+		return "anonymous"
+	case TierNormal:
+		return "normal"
+	case TierKnown:
+		return "known"
+	case TierVerified:
+		return "verified"
+	default:
+		return "unknown"
+	}
+}
+
+// JoinLimit is the JOIN budget of the tier
+func (t Tier) JoinLimit() RateLimit {
+	switch t {
+	case TierKnown:
+		return JoinLimitKnown
+	case TierVerified:
+		return JoinLimitVerified
+	default:
+		return JoinLimitAnonymous
+	}
+}
@@ -0,0 +1,53 @@
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTier(t *testing.T) {
+	testCases := []struct {
+		tier    string
+		want    Tier
+		wantErr bool
+	}{
+		{"", TierAnonymous, false},
+		{"anonymous", TierAnonymous, false},
+		{"normal", TierNormal, false},
+		{"Known", TierKnown, false},
+		{"verified", TierVerified, false},
+		{"partner", TierAnonymous, true},
+	}
+
+	for _, testCase := range testCases {
+		got, err := ParseTier(testCase.tier)
+
+		if (err != nil) != testCase.wantErr {
+			t.Errorf("%s: got error %v", testCase.tier, err)
+		}
+
+		if got != testCase.want {
+			t.Errorf("%s: got %v, want %v", testCase.tier, got, testCase.want)
+		}
+	}
+}
+
+func TestTierLimits(t *testing.T) {
+	if TierVerified.JoinLimit() != JoinLimitVerified {
+		t.Errorf("got %v, want %v", TierVerified.JoinLimit(), JoinLimitVerified)
+	}
+
+	if TierAnonymous.JoinLimit() != JoinLimitAnonymous {
+		t.Errorf("got %v, want %v", TierAnonymous.JoinLimit(), JoinLimitAnonymous)
+	}
+
+	custom := RateLimit{Count: 50, Period: 15 * time.Second}
+
+	if got := (ManagerOptions{Tier: TierKnown, JoinLimit: custom}).joinLimit(); got != custom {
+		t.Errorf("got %v, want the configured %v", got, custom)
+	}
+
+	if got := (ManagerOptions{Tier: TierKnown}).joinLimit(); got != JoinLimitAnonymous {
+		t.Errorf("got %v without a configured limit, want the regular %v", got, JoinLimitAnonymous)
+	}
+}
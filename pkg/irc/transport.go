@@ -0,0 +1,160 @@
+package irc
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownScheme = errors.New("unknown address scheme")
+)
+
+const (
+	// TLS_CONNECTION_ADDRESS is the plain IRC endpoint, for networks which block websockets
+	TLS_CONNECTION_ADDRESS = "ircs://irc.chat.twitch.tv:6697"
+
+	DIAL_TIMEOUT = 10 * time.Second
+)
+
+// Transport carries IRC lines to and from the server.
+//
+// ReadLine and WriteLine may be called at the same time from different goroutines,
+// but not concurrently with themselves.
+type Transport interface {
+	// ReadLine blocks until a line arrives, it is returned without the trailing \r\n
+	ReadLine() (string, error)
+	// WriteLine sends a single line, the \r\n is added if the transport needs it
+	WriteLine(line string) error
+	Close() error
+}
+
+// Dial opens a transport for the address, the scheme picks the implementation.
+//
+//	ws:// and wss:// use websockets
+//	irc:// is plain TCP
+//	ircs:// is TCP with TLS
+func Dial(address string) (Transport, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "ws", "wss":
+		{
+			return dialWebsocket(address)
+		}
+	case "irc":
+		{
+			conn, err := net.DialTimeout("tcp", u.Host, DIAL_TIMEOUT)
+			if err != nil {
+				return nil, err
+			}
+
+			return newLineTransport(conn), nil
+		}
+	case "ircs":
+		{
+			dialer := &net.Dialer{Timeout: DIAL_TIMEOUT}
+
+			conn, err := tls.DialWithDialer(dialer, "tcp", u.Host, &tls.Config{
+				ServerName: u.Hostname(),
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			return newLineTransport(conn), nil
+		}
+	default:
+		return nil, ErrUnknownScheme
+	}
+}
+
+// websocketTransport sends one line per frame, Twitch may put several lines in a frame it sends
+type websocketTransport struct {
+	conn    *websocket.Conn
+	pending []string
+}
+
+func dialWebsocket(address string) (*websocketTransport, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(address, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &websocketTransport{conn: conn}, nil
+}
+
+func (t *websocketTransport) ReadLine() (string, error) {
+	for len(t.pending) == 0 {
+		msgType, msg, err := t.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				zap.S().Errorw("Unexpected close from websocket error", "error", err)
+			}
+
+			return "", err
+		}
+
+		if msgType != websocket.TextMessage {
+			zap.S().Errorw("Received non-text message from server", "type", msgType)
+			continue
+		}
+
+		t.pending = strings.Split(strings.TrimSuffix(string(msg), "\r\n"), "\r\n")
+	}
+
+	line := t.pending[0]
+	t.pending = t.pending[1:]
+
+	return line, nil
+}
+
+func (t *websocketTransport) WriteLine(line string) error {
+	return t.conn.WriteMessage(websocket.TextMessage, []byte(line))
+}
+
+func (t *websocketTransport) Close() error {
+	return t.conn.Close()
+}
+
+// lineTransport speaks IRC over a stream, lines are separated by \r\n
+type lineTransport struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newLineTransport(conn net.Conn) *lineTransport {
+	return &lineTransport{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+func (t *lineTransport) ReadLine() (string, error) {
+	line, err := t.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (t *lineTransport) WriteLine(line string) error {
+	_, err := t.conn.Write([]byte(line + "\r\n"))
+
+	return err
+}
+
+func (t *lineTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,108 @@
+package irc
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDialUnknownScheme(t *testing.T) {
+	if _, err := Dial("http://irc.chat.twitch.tv"); err != ErrUnknownScheme {
+		t.Errorf("got %v, want %v", err, ErrUnknownScheme)
+	}
+}
+
+func TestLineTransport(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte(":tmi.twitch.tv 001 justinfan123 :Welcome, GLHF!\r\n:tmi.twitch.tv 376 justinfan123 :>\r\n"))
+
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	tr, err := Dial("irc://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	for _, want := range []string{
+		":tmi.twitch.tv 001 justinfan123 :Welcome, GLHF!",
+		":tmi.twitch.tv 376 justinfan123 :>",
+	} {
+		got, err := tr.ReadLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertEqual(t, got, want)
+	}
+
+	if err := tr.WriteLine("NICK justinfan123"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, <-received, "NICK justinfan123\r\n")
+}
+
+func TestWebsocketTransportSplitsFrames(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	received := make(chan string, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte("PING :tmi.twitch.tv\r\n:tmi.twitch.tv 376 justinfan123 :>\r\n"))
+
+		_, msg, _ := conn.ReadMessage()
+		received <- string(msg)
+	}))
+	defer srv.Close()
+
+	tr, err := Dial("ws" + strings.TrimPrefix(srv.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	got := []string{}
+	for i := 0; i < 2; i++ {
+		line, err := tr.ReadLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, line)
+	}
+
+	assertEqual(t, strings.Join(got, "|"), "PING :tmi.twitch.tv|:tmi.twitch.tv 376 justinfan123 :>")
+
+	if err := tr.WriteLine("PONG :tmi.twitch.tv"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(t, <-received, "PONG :tmi.twitch.tv")
+}
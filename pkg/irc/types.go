@@ -1,5 +1,10 @@
 package irc
 
+import (
+	"strconv"
+	"time"
+)
+
 type Tags map[string]string
 
 type MessageType int
@@ -14,8 +19,55 @@ const (
 	ENDOFMOTD = MessageType(iota)
 	JOIN      = MessageType(iota)
 	PART      = MessageType(iota)
+
+	USERNOTICE      = MessageType(iota)
+	CLEARCHAT       = MessageType(iota)
+	CLEARMSG        = MessageType(iota)
+	ROOMSTATE       = MessageType(iota)
+	USERSTATE       = MessageType(iota)
+	GLOBALUSERSTATE = MessageType(iota)
+	WHISPER         = MessageType(iota)
 )
 
+// ConnectionState is the lifecycle state of an IrcConnection
+type ConnectionState int
+
+const (
+	// StateDisconnected means the socket was lost and a reconnect may follow
+	StateDisconnected = ConnectionState(iota)
+	// StateConnecting means a socket is being opened and we wait for the MOTD
+	StateConnecting = ConnectionState(iota)
+	// StateReady means the server accepted us and commands can be sent
+	StateReady = ConnectionState(iota)
+	// StateClosed means the connection was closed or gave up reconnecting, it will not come back
+	StateClosed = ConnectionState(iota)
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateReady:
+		return "ready"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// parseTimestamp parses a millisecond unix timestamp, such as tmi-sent-ts
+func parseTimestamp(ms string) time.Time {
+	v, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(v)
+}
+
 type Message interface {
 	GetType() MessageType
 }
@@ -45,6 +97,117 @@ func (m *PrivmsgMessage) UserID() string {
 	return m.Tags["user-id"]
 }
 
+// ID is the unique id of the message, used for replies and deletions
+func (m *PrivmsgMessage) ID() string {
+	return m.Tags["id"]
+}
+
+func (m *PrivmsgMessage) RoomID() string {
+	return m.Tags["room-id"]
+}
+
+// Timestamp is when Twitch received the message, zero if unknown
+func (m *PrivmsgMessage) Timestamp() time.Time {
+	return parseTimestamp(m.Tags["tmi-sent-ts"])
+}
+
+func (m *PrivmsgMessage) DisplayName() string {
+	return m.Tags["display-name"]
+}
+
+// Color is the users name color as #RRGGBB, empty if they never picked one
+func (m *PrivmsgMessage) Color() string {
+	return m.Tags["color"]
+}
+
+// IsEmoteOnly reports if the message is made up of only Twitch emotes
+func (m *PrivmsgMessage) IsEmoteOnly() bool {
+	return m.Tags["emote-only"] == "1"
+}
+
+func (m *PrivmsgMessage) IsFirstMessage() bool {
+	return m.Tags["first-msg"] == "1"
+}
+
+// Bits is the amount of bits cheered in the message
+func (m *PrivmsgMessage) Bits() int {
+	bits, _ := strconv.Atoi(m.Tags["bits"])
+
+	return bits
+}
+
+func (m *PrivmsgMessage) Badges() Badges {
+	return parseBadges(m.Tags["badges"])
+}
+
+// BadgeInfo holds extra data for some badges, such as the exact months for subscriber
+func (m *PrivmsgMessage) BadgeInfo() Badges {
+	return parseBadges(m.Tags["badge-info"])
+}
+
+func (m *PrivmsgMessage) IsModerator() bool {
+	return m.Tags["mod"] == "1" || m.Badges().Has("moderator")
+}
+
+func (m *PrivmsgMessage) IsVIP() bool {
+	return m.Tags["vip"] == "1" || m.Badges().Has("vip")
+}
+
+func (m *PrivmsgMessage) IsBroadcaster() bool {
+	return m.Badges().Has("broadcaster")
+}
+
+func (m *PrivmsgMessage) IsSubscriber() bool {
+	badges := m.Badges()
+
+	return m.Tags["subscriber"] == "1" || badges.Has("subscriber") || badges.Has("founder")
+}
+
+// SubscriberMonths is the amount of months the user has been subscribed, 0 if not subscribed
+func (m *PrivmsgMessage) SubscriberMonths() int {
+	info := m.BadgeInfo()
+
+	if badge, ok := info.Get("subscriber"); ok {
+		return badge.VersionInt()
+	}
+
+	if badge, ok := info.Get("founder"); ok {
+		return badge.VersionInt()
+	}
+
+	return 0
+}
+
+// Emotes returns the native Twitch emotes in the message, ordered by position
+func (m *PrivmsgMessage) Emotes() []Emote {
+	return parseEmotes(m.Tags["emotes"], m.Message)
+}
+
+// ReplyParent describes the message this message replied to
+type ReplyParent struct {
+	MsgID       string
+	UserID      string
+	UserLogin   string
+	DisplayName string
+	Body        string
+}
+
+// ReplyParent returns the message this is a reply to, false if it is not a reply
+func (m *PrivmsgMessage) ReplyParent() (ReplyParent, bool) {
+	id, ok := m.Tags["reply-parent-msg-id"]
+	if !ok || id == "" {
+		return ReplyParent{}, false
+	}
+
+	return ReplyParent{
+		MsgID:       id,
+		UserID:      m.Tags["reply-parent-user-id"],
+		UserLogin:   m.Tags["reply-parent-user-login"],
+		DisplayName: m.Tags["reply-parent-display-name"],
+		Body:        m.Tags["reply-parent-msg-body"],
+	}, true
+}
+
 type PingMessage struct {
 	Raw     string
 	Message string
@@ -111,3 +274,189 @@ type PartMessage struct {
 func (m *PartMessage) GetType() MessageType {
 	return PART
 }
+
+// UserNoticeMessage is sent for subs, resubs, gifts, raids, announcements and similar events
+type UserNoticeMessage struct {
+	Raw     string
+	Channel string
+	User    string
+	// Message is the optional message the user attached
+	Message string
+	// MsgID is the kind of event, such as sub, resub, subgift, raid or announcement
+	MsgID     string
+	SystemMsg string
+	// MsgParams holds the msg-param-* tags without the msg-param- prefix
+	MsgParams Tags
+	Tags      Tags
+}
+
+func (m *UserNoticeMessage) GetType() MessageType {
+	return USERNOTICE
+}
+
+func (m *UserNoticeMessage) UserID() string {
+	return m.Tags["user-id"]
+}
+
+// ClearChatMessage is sent when a user is banned or timed out, or the whole chat is cleared
+type ClearChatMessage struct {
+	Raw     string
+	Channel string
+	// TargetUser is empty when the whole chat was cleared
+	TargetUser   string
+	TargetUserID string
+	// BanDuration is 0 for permanent bans
+	BanDuration time.Duration
+	Tags        Tags
+}
+
+func (m *ClearChatMessage) GetType() MessageType {
+	return CLEARCHAT
+}
+
+func (m *ClearChatMessage) IsFullClear() bool {
+	return m.TargetUser == ""
+}
+
+func (m *ClearChatMessage) IsBan() bool {
+	return m.TargetUser != "" && m.BanDuration == 0
+}
+
+func (m *ClearChatMessage) IsTimeout() bool {
+	return m.TargetUser != "" && m.BanDuration > 0
+}
+
+// ClearMsgMessage is sent when a single message is deleted
+type ClearMsgMessage struct {
+	Raw         string
+	Channel     string
+	User        string
+	TargetMsgID string
+	Message     string
+	Tags        Tags
+}
+
+func (m *ClearMsgMessage) GetType() MessageType {
+	return CLEARMSG
+}
+
+// RoomStateMessage is sent when joining a channel and whenever one of its chat settings change.
+//
+// On changes only the changed setting is included, so the accessors report if the setting was present.
+type RoomStateMessage struct {
+	Raw     string
+	Channel string
+	RoomID  string
+	Tags    Tags
+}
+
+func (m *RoomStateMessage) GetType() MessageType {
+	return ROOMSTATE
+}
+
+func (m *RoomStateMessage) boolTag(name string) (bool, bool) {
+	v, ok := m.Tags[name]
+	if !ok {
+		return false, false
+	}
+
+	return v == "1", true
+}
+
+func (m *RoomStateMessage) EmoteOnly() (bool, bool) {
+	return m.boolTag("emote-only")
+}
+
+func (m *RoomStateMessage) SubsOnly() (bool, bool) {
+	return m.boolTag("subs-only")
+}
+
+func (m *RoomStateMessage) R9K() (bool, bool) {
+	return m.boolTag("r9k")
+}
+
+// Slow returns the time a user has to wait between messages, 0 means slow mode is off
+func (m *RoomStateMessage) Slow() (time.Duration, bool) {
+	v, ok := m.Tags["slow"]
+	if !ok {
+		return 0, false
+	}
+
+	seconds, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
+
+// FollowersOnly returns how long a user must have followed to chat, a negative duration means followers-only is off
+func (m *RoomStateMessage) FollowersOnly() (time.Duration, bool) {
+	v, ok := m.Tags["followers-only"]
+	if !ok {
+		return 0, false
+	}
+
+	minutes, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, false
+	}
+
+	if minutes < 0 {
+		return -1, true
+	}
+
+	return time.Duration(minutes) * time.Minute, true
+}
+
+// UserStateMessage describes ourselves in a channel, it is sent on join and after we send a message
+type UserStateMessage struct {
+	Raw     string
+	Channel string
+	Tags    Tags
+}
+
+func (m *UserStateMessage) GetType() MessageType {
+	return USERSTATE
+}
+
+// IsModerator reports if we are a moderator or the broadcaster of the channel
+func (m *UserStateMessage) IsModerator() bool {
+	return m.Tags["mod"] == "1" || parseBadges(m.Tags["badges"]).Has("broadcaster")
+}
+
+// GlobalUserStateMessage describes ourselves, it is sent once after authenticating
+type GlobalUserStateMessage struct {
+	Raw  string
+	Tags Tags
+}
+
+func (m *GlobalUserStateMessage) GetType() MessageType {
+	return GLOBALUSERSTATE
+}
+
+func (m *GlobalUserStateMessage) UserID() string {
+	return m.Tags["user-id"]
+}
+
+func (m *GlobalUserStateMessage) DisplayName() string {
+	return m.Tags["display-name"]
+}
+
+type WhisperMessage struct {
+	Raw string
+	// User is who sent the whisper
+	User string
+	// Target is who received the whisper
+	Target  string
+	Message string
+	Tags    Tags
+}
+
+func (m *WhisperMessage) GetType() MessageType {
+	return WHISPER
+}
+
+func (m *WhisperMessage) UserID() string {
+	return m.Tags["user-id"]
+}